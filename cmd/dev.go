@@ -72,6 +72,7 @@ func RunE() (variant.Opts, error) {
 			return opts, variant.NewInitError(err)
 		}
 		taskDef = taskConfigFromFile
+		opts.Variantfile = varfile
 	} else {
 		taskDef = variant.NewDefaultTaskConfig()
 	}
@@ -85,6 +86,7 @@ func RunE() (variant.Opts, error) {
 		UtilsCmd,
 		VersionCmd(logrus.StandardLogger()),
 	}
+	opts.AppCmds = []func(*variant.Application) *cobra.Command{RunsCmd}
 
 	_, err = Run(taskDef, opts)
 	return opts, err
@@ -109,6 +111,7 @@ func YAML(yaml string) {
 			EnvCmd,
 			VersionCmd(logrus.StandardLogger()),
 		},
+		AppCmds: []func(*variant.Application) *cobra.Command{RunsCmd},
 	}
 
 	if _, err := Run(taskDef, opts); err != nil {
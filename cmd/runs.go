@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	variant "github.com/mumoshu/variant/pkg"
+	"github.com/mumoshu/variant/pkg/jobs"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// RunsCmd returns the command to submit tasks of the app as asynchronous runs and to manage them
+func RunsCmd(app *variant.Application) *cobra.Command {
+	var dir string
+
+	api := func() *jobs.Jobs {
+		return jobs.New(app, jobs.NewStore(dir))
+	}
+
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "Submit tasks to be run asynchronously and manage the runs",
+		Long: `Submit tasks to be run asynchronously and manage the runs.
+
+Submitted runs are executed by "runs serve", which runs up to --workers runs at once.
+Two runs of the same task against the same environment are never run at once.
+With --listen, "runs serve" also serves the HTTP API to submit, list, tail and cancel runs.
+
+Example:
+mycmd runs submit cluster.upgrade --version 1.15
+mycmd runs serve --workers 2 --listen :8080
+mycmd runs ls
+mycmd runs logs -f <run id>
+mycmd runs cancel <run id>
+`,
+	}
+
+	cmd.PersistentFlags().StringVar(&dir, "runs-dir", jobs.DefaultDir, "Directory to persist runs and their logs")
+
+	submit := &cobra.Command{
+		Use:   "submit TASK [ARGS...]",
+		Short: "Queue a run of the task. TASK is the dot-separated name of the task like `cluster.upgrade`. Inputs are given as `--name=value` or `--name value`",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			j := api()
+			taskArgs, flags := parseTaskArgs(args[1:])
+			arguments, err := j.ArgumentsFromFlags(args[0], flags)
+			if err != nil {
+				return err
+			}
+			r, err := j.Submit(args[0], taskArgs, arguments)
+			if err != nil {
+				return err
+			}
+			fmt.Println(r.ID)
+			return nil
+		},
+	}
+	// Pass everything after the task name to the task as-is
+	submit.Flags().SetInterspersed(false)
+
+	var workers int
+	var pollInterval time.Duration
+	var listen string
+
+	serve := &cobra.Command{
+		Use:   "serve",
+		Short: "Execute submitted runs until interrupted, optionally serving the HTTP API to submit and manage runs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+			defer stop()
+
+			j := api()
+			if listen == "" {
+				return j.Serve(ctx, workers, pollInterval)
+			}
+
+			server := &http.Server{Addr: listen, Handler: j.Handler()}
+			served := make(chan error, 1)
+			go func() {
+				served <- j.Serve(ctx, workers, pollInterval)
+			}()
+			go func() {
+				<-ctx.Done()
+				server.Shutdown(context.Background())
+			}()
+			logrus.Infof("serving the runs API on %s", listen)
+			if err := server.ListenAndServe(); err != http.ErrServerClosed {
+				stop()
+				<-served
+				return err
+			}
+			return <-served
+		},
+	}
+	serve.Flags().IntVar(&workers, "workers", 2, "Max number of runs executed at once")
+	serve.Flags().DurationVar(&pollInterval, "poll-interval", time.Second, "Interval to look for submitted and cancelled runs")
+	serve.Flags().StringVar(&listen, "listen", "", "Address like `:8080` to serve the HTTP API to submit and manage runs on. The API isn't served when empty")
+
+	ls := &cobra.Command{
+		Use:   "ls",
+		Short: "List runs",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runs, err := api().List()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tTASK\tENV\tSTATUS\tSUBMITTED\tDURATION")
+			for _, r := range runs {
+				var duration string
+				if r.StartedAt != nil {
+					end := time.Now()
+					if r.FinishedAt != nil {
+						end = *r.FinishedAt
+					}
+					duration = end.Sub(*r.StartedAt).Round(time.Second).String()
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.ID, r.Task, r.Env, r.Status, r.SubmittedAt.Format(time.RFC3339), duration)
+			}
+			return w.Flush()
+		},
+	}
+
+	var follow bool
+
+	logs := &cobra.Command{
+		Use:   "logs RUN_ID",
+		Short: "Print the log of the run",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return api().Logs(context.Background(), args[0], follow, os.Stdout)
+		},
+	}
+	logs.Flags().BoolVarP(&follow, "follow", "f", false, "Keep printing the log until the run finishes")
+
+	cancel := &cobra.Command{
+		Use:   "cancel RUN_ID",
+		Short: "Cancel the queued or running run",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := api().Cancel(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Requested cancellation of run %s\n", args[0])
+			return nil
+		},
+	}
+
+	cmd.AddCommand(submit, serve, ls, logs, cancel)
+
+	return cmd
+}
+
+// parseTaskArgs splits the args given after the task name into the positional arguments, and the values of the flags
+// given as `--name=value` or `--name value` keyed by their names. A flag without a value is `true`. Args after `--`
+// are all positional.
+func parseTaskArgs(args []string) ([]string, map[string]string) {
+	positional := []string{}
+	flags := map[string]string{}
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if !strings.HasPrefix(a, "--") {
+			positional = append(positional, a)
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(a, "--"), "=", 2)
+		switch {
+		case len(kv) == 2:
+			flags[kv[0]] = kv[1]
+		case i+1 < len(args) && !strings.HasPrefix(args[i+1], "--"):
+			flags[kv[0]] = args[i+1]
+			i++
+		default:
+			flags[kv[0]] = "true"
+		}
+	}
+	return positional, flags
+}
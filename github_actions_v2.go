@@ -29,12 +29,13 @@ func sendGitHubComment(name, command, exitstatus, summary, details string) (err
 			err = variant.NewInternalError(fmt.Errorf("unable to send a comment to GitHub Issue/PR: %v", err))
 		}
 	}()
+	// The comment is visible to anyone who can read the issue or pull request
 	data := map[string]string{
 		"Name":       name,
-		"Command":    command,
+		"Command":    variant.MaskSecrets(command),
 		"ExitStatus": exitstatus,
-		"Summary":    summary,
-		"Details":    details,
+		"Summary":    variant.MaskSecrets(summary),
+		"Details":    variant.MaskSecrets(details),
 	}
 
 	tpl := template.New("comment")
@@ -1,6 +1,7 @@
 package variant
 
 import (
+	gocontext "context"
 	"fmt"
 	"github.com/mumoshu/variant/pkg/util/fileutil"
 	"os"
@@ -10,6 +11,7 @@ import (
 	bunyan "github.com/mumoshu/logrus-bunyan-formatter"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 
 	"encoding/json"
@@ -18,15 +20,19 @@ import (
 	"github.com/mumoshu/variant/pkg/api/task"
 	"github.com/mumoshu/variant/pkg/get"
 	"github.com/mumoshu/variant/pkg/util/maputil"
+	"github.com/mumoshu/variant/pkg/util/stringutil"
 	"github.com/xeipuuv/gojsonschema"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v2"
 	"reflect"
 	"strconv"
+	"time"
 )
 
 type Application struct {
 	Name                string
 	CommandRelativePath string
+	Variantfile         string
 	CachedTaskOutputs   map[string]interface{}
 	ConfigFile          string
 	Verbose             bool
@@ -38,6 +44,15 @@ type Application struct {
 	InputResolver       InputResolver
 	TaskNamer           *TaskNamer
 	LogToStderr         bool
+	EventsFile          string
+	Timings             bool
+	TimingsTrace        string
+	TraceExporter       string
+	TraceFile           string
+	JUnitReport         string
+	NoInput             bool
+	Yes                 bool
+	ContainerRuntime    string
 
 	LogLevel      string
 	LogColorPanic string
@@ -56,6 +71,34 @@ type Application struct {
 
 	Log *logrus.Logger
 
+	// Events receives the events of task runs, to be written to `--events-file` or recorded for `--timings`
+	Events EventSinks
+
+	// TimingRecorder records durations of tasks and steps for `--timings` and `--timings-trace`. Nil when both are unset
+	TimingRecorder *TimingRecorder
+
+	// Tracing records OpenTelemetry spans of task runs. Nil when neither `--trace-exporter` nor `--trace-file` is set
+	Tracing *Tracing
+
+	// JUnitReporter records tasks and steps as test cases for `--junit-report`. Nil when it is unset
+	JUnitReporter *JUnitReporter
+
+	// inputFlags are the flags generated for inputs, keyed by the config keys they are bound to
+	inputFlags map[string]*pflag.Flag
+
+	// Prompter asks for missing required inputs. Nil when stdin is not a terminal or `--no-input` is set
+	Prompter *InputPrompter
+
+	// envFiles are the variables loaded from the `envFiles` of the task whose inputs are being collected,
+	// looked up along with the environment variables for `bindParamsFromEnv`
+	envFiles envFileVars
+
+	// workspace is the per-run directory to pass files between steps via `produces` and `consumes`
+	workspace *workspace
+
+	// ctx kills the scripts being run once it's done. Nil except for runs started with RunInBackground
+	ctx gocontext.Context
+
 	ConfigContexts []string
 	ConfigDirs     []string
 	CommandName    string
@@ -71,6 +114,15 @@ func (p *Application) setGlobalParams() {
 	p.LogToStderr = p.Viper.GetBool("logtostderr")
 	p.Output = p.Viper.GetString("output")
 	p.ConfigFile = p.Viper.GetString("config-file")
+	p.EventsFile = p.Viper.GetString("events-file")
+	p.Timings = p.Viper.GetBool("timings")
+	p.TimingsTrace = p.Viper.GetString("timings-trace")
+	p.TraceExporter = p.Viper.GetString("trace-exporter")
+	p.TraceFile = p.Viper.GetString("trace-file")
+	p.JUnitReport = p.Viper.GetString("junit-report")
+	p.NoInput = p.Viper.GetBool("no-input")
+	p.Yes = p.Viper.GetBool("yes")
+	p.ContainerRuntime = p.Viper.GetString("container-runtime")
 
 	p.LogLevel = p.Viper.GetString("log-level")
 	p.LogColorPanic = p.Viper.GetString("log-color-panic")
@@ -104,6 +156,35 @@ func (p *Application) setGlobalParams() {
 	p.ConfigDirs = maputil.SliceUnique(append([]string{filepath.Dir(p.CommandRelativePath), "."}, p.ConfigDirs...))
 }
 
+// ReportTimings prints the timing report and writes the trace file, as requested via `--timings` and `--timings-trace`
+func (p *Application) ReportTimings() error {
+	if p.TimingRecorder == nil {
+		return nil
+	}
+	if p.Timings {
+		p.TimingRecorder.PrintReport(os.Stderr, 5)
+	}
+	if p.TimingsTrace != "" {
+		f, err := os.Create(p.TimingsTrace)
+		if err != nil {
+			return errors.Wrapf(err, "failed to create timings trace file")
+		}
+		defer f.Close()
+		if err := p.TimingRecorder.WriteChromeTrace(f); err != nil {
+			return errors.Wrapf(err, "failed to write timings trace file")
+		}
+	}
+	return nil
+}
+
+// WriteJUnitReport writes the JUnit XML report requested via `--junit-report`
+func (p *Application) WriteJUnitReport() error {
+	if p.JUnitReporter == nil {
+		return nil
+	}
+	return p.JUnitReporter.WriteReportFile(p.JUnitReport)
+}
+
 func (p *Application) loadContextConfigs() {
 	var contexts []string
 	for _, c := range p.ConfigContexts {
@@ -206,25 +287,96 @@ func (p *Application) RunTaskForKeyString(keyStr string, args []string, argument
 func (p *Application) Run(taskName TaskName, args []string) error {
 	p.LastRun = taskName.ShortString()
 
+	started := time.Now()
+	p.Events.Emit(Event{Type: EventRunStarted, App: p.Name, Task: taskName.ShortString(), Args: args})
+
 	errMsg, err := p.RunTask(taskName, args, task.NewArguments(), map[string]interface{}{}, false)
 
+	finished := Event{Type: EventRunFinished, App: p.Name, Task: taskName.ShortString()}.withDurationSince(started)
+	if err != nil {
+		finished.Error = err.Error()
+	}
+	p.Events.Emit(finished)
+
 	if err != nil {
 		return CommandError{error: err, TaskName: taskName, Cause: errMsg}
 	}
 	return nil
 }
 
-func (p *Application) RunTask(taskName TaskName, args []string, arguments task.Arguments, scope map[string]interface{}, asInput bool, caller ...*Task) (string, error) {
+// RunInBackground runs the task independently of the other runs of the app, for runs submitted to `runs serve`.
+// The run gets its own cache of task outputs and workspace, never prompts, emits its events to sink as well, and
+// kills the scripts being run once ctx is done.
+// Timings, test cases and spans are recorded separately from the runs running concurrently, and added to the ones of
+// the app once the run finishes.
+func (p *Application) RunInBackground(ctx gocontext.Context, taskName TaskName, args []string, arguments task.Arguments, sink EventSink) (string, error) {
+	run := *p
+	run.CachedTaskOutputs = map[string]interface{}{}
+	run.Events = EventSinks{}
+	for _, s := range p.Events {
+		if s != EventSink(p.TimingRecorder) && s != EventSink(p.JUnitReporter) {
+			run.Events = append(run.Events, s)
+		}
+	}
+	if p.TimingRecorder != nil {
+		run.TimingRecorder = NewTimingRecorder()
+		run.Events = append(run.Events, run.TimingRecorder)
+	}
+	if p.JUnitReporter != nil {
+		run.JUnitReporter = NewJUnitReporter(p.Name)
+		run.Events = append(run.Events, run.JUnitReporter)
+	}
+	run.Events = append(run.Events, sink)
+	run.Tracing = p.Tracing.fork()
+	run.Prompter = nil
+	run.workspace = newWorkspace()
+	run.ctx = ctx
+	defer func() {
+		if err := run.workspace.remove(); err != nil {
+			p.Log.Errorf("failed to remove the workspace: %v", err)
+		}
+		if p.TimingRecorder != nil {
+			p.TimingRecorder.merge(run.TimingRecorder)
+		}
+		if p.JUnitReporter != nil {
+			p.JUnitReporter.merge(run.JUnitReporter)
+		}
+	}()
+	return run.RunTask(taskName, args, arguments, map[string]interface{}{}, false)
+}
+
+func (p *Application) RunTask(taskName TaskName, args []string, arguments task.Arguments, scope map[string]interface{}, asInput bool, caller ...*Task) (output string, err error) {
 	var ctx *logrus.Entry
 
+	taskEvent := Event{App: p.Name, Task: taskName.ShortString()}
+	spanAttrs := []attribute.KeyValue{attrApp.String(p.Name), attrTask.String(taskName.ShortString()), attrEnv.String(p.Env)}
+
 	if len(caller) == 1 {
 		ctx = p.Log.WithFields(logrus.Fields{"app": p.Name, "task": taskName.ShortString(), "caller": caller[0].GetKey().ShortString()})
+		taskEvent.Caller = caller[0].GetKey().ShortString()
+		spanAttrs = append(spanAttrs, attrCaller.String(taskEvent.Caller))
 	} else {
 		ctx = p.Log.WithFields(logrus.Fields{"app": p.Name, "task": taskName.ShortString()})
 	}
 
 	ctx.Debugf("app started task %s", taskName.ShortString())
 
+	started := time.Now()
+	taskEvent.Type = EventTaskStarted
+	p.Events.Emit(taskEvent)
+
+	span := p.Tracing.start(fmt.Sprintf("task %s", taskName.ShortString()), spanAttrs...)
+
+	var inputs map[string]interface{}
+
+	defer func() {
+		span.end(err)
+		finished := taskEvent.withDurationSince(started).withResult(output, err)
+		finished.Type = EventTaskFinished
+		finished.Inputs = inputs
+		p.Events.Emit(finished)
+	}()
+
 	//provided := p.GetTmplOrTypedValueForConfigKey(taskName.ShortString(), "string")
 	//
 	//if provided != nil {
@@ -246,7 +398,7 @@ func (p *Application) RunTask(taskName TaskName, args []string, arguments task.A
 	vars["env"] = p.Env
 	vars["cmd"] = p.CommandRelativePath
 
-	inputs, err := p.InheritedInputValuesForTaskKey(taskName, args, arguments, scope, caller...)
+	inputs, err = p.InheritedInputValuesForTaskKey(taskName, args, arguments, scope, caller...)
 
 	if err != nil {
 		return "", errors.Wrapf(err, "%s failed running task %s", p.Name, taskName.ShortString())
@@ -292,14 +444,26 @@ func (p *Application) RunTask(taskName TaskName, args []string, arguments task.A
 				// Err implements the ResultError interface
 				ctx.Debugf("- %s", err)
 			}
-			firstErr := result.Errors()[0]
-			return firstErr.String(), fmt.Errorf("argument %q of task %q is invalid", firstErr.Field(), taskName)
+			return "", &InputValidationError{TaskName: taskName.ShortString(), Violations: inputViolationsFromResult(taskDef.Inputs, vars, result)}
 		}
 
 		ctx.WithField("variables", kv).Debugf("app bound variables for task %s", taskName.ShortString())
 	}
 
+	files, err := p.fileInputTemplateValues(taskName, vars)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read file inputs of task %s", taskName.ShortString())
+	}
+	if _, ok := vars["files"]; !ok && len(files) > 0 {
+		vars["files"] = files
+	}
+
 	taskTemplate := NewTaskTemplate(taskDef, vars)
+
+	if err := p.confirm(taskDef, taskTemplate); err != nil {
+		return "", err
+	}
+
 	taskRunner, err := NewTaskRunner(taskDef, taskTemplate, vars)
 	if err != nil {
 		return "", errors.Wrapf(err, "failed to initialize task runner")
@@ -328,6 +492,9 @@ func (p Application) InheritedInputValuesForTaskKey(taskName TaskName, args []st
 
 	for k, _ := range taskName.Components {
 		direct, err := p.DirectInputValuesForTaskKey(TaskName{Components: taskName.Components[:k+1]}, args, arguments, scope, caller...)
+		if _, ok := err.(*InputValidationError); ok {
+			return nil, err
+		}
 		if err != nil {
 			return nil, errors.Wrapf(err, "missing input for task `%s`", taskName.ShortString())
 		}
@@ -355,6 +522,68 @@ func sourceToObject(v interface{}) (map[string]interface{}, error) {
 }
 
 func (p Application) GetTmplOrTypedValueForConfigKey(k string, tpe string, bindEnvVars bool) interface{} {
+	v, _ := p.tmplOrTypedValueForConfigKey(k, tpe, bindEnvVars)
+	return v
+}
+
+// defaultTemplateValues returns the values to render default templates with, which are the caller's values, the env
+// and the inputs of the task resolved so far
+func (p Application) defaultTemplateValues(scope, resolved map[string]interface{}) map[string]interface{} {
+	values := map[string]interface{}{}
+	for k, v := range scope {
+		values[k] = v
+	}
+	values["env"] = p.Env
+	maputil.DeepMerge(values, resolved)
+	return values
+}
+
+// inputValueForAliases looks for the value of the input under its aliases, in the same order as its name.
+// keys are the config keys for the input's name. The first key is used only when the task is called by another task.
+func (p Application) inputValueForAliases(input *Input, arguments task.Arguments, keys []string, hasBaseTask, bindEnvVars bool) (interface{}, string, error) {
+	for _, alias := range input.Aliases {
+		var v interface{}
+		var source string
+
+		if str, err := arguments.GetString(alias); err == nil && str != "" {
+			v, err = p.parseSupportedValueFromString(str, input.TypeName())
+			if err != nil {
+				return nil, "", err
+			}
+			source = fmt.Sprintf("argument `%s` given by the caller", alias)
+		}
+
+		for i, k := range keys {
+			if v != nil {
+				break
+			}
+			if i == 0 && !hasBaseTask {
+				continue
+			}
+			aliasKey := input.aliasOf(k, alias)
+			if aliasKey == "" {
+				continue
+			}
+			v, source = p.tmplOrTypedValueForConfigKey(aliasKey, input.TypeName(), bindEnvVars)
+		}
+
+		if v == nil {
+			continue
+		}
+
+		// Deprecated flags are warned by cobra
+		if input.Deprecated != "" && !strings.HasPrefix(source, "flag ") {
+			p.Log.Warnf("`%s` given via %s is deprecated: %s", alias, source, input.Deprecated)
+		}
+
+		return v, source, nil
+	}
+	return nil, "", nil
+}
+
+// tmplOrTypedValueForConfigKey is GetTmplOrTypedValueForConfigKey that also returns where the value came from,
+// so that users can tell what to fix when the value is invalid
+func (p Application) tmplOrTypedValueForConfigKey(k string, tpe string, bindEnvVars bool) (interface{}, string) {
 	ctx := p.Log.WithFields(logrus.Fields{"app": p.Name, "key": k})
 
 	convert := func(v interface{}) (interface{}, bool) {
@@ -393,17 +622,18 @@ func (p Application) GetTmplOrTypedValueForConfigKey(k string, tpe string, bindE
 	ctx.Debugf("fetching %s for %s", k, tpe)
 
 	flagKey := fmt.Sprintf("flags.%s", k)
-	valueFromFlag := p.Viper.Get(flagKey)
+	valueFromFlag := p.inputFlagValue(flagKey)
 	ctx.Debugf("fetched %s: %v(%T)", flagKey, valueFromFlag, valueFromFlag)
 	if valueFromFlag != nil && valueFromFlag != "" {
 		if any, ok := convert(valueFromFlag); ok {
-			return any
+			return any, fmt.Sprintf("flag --%s", stringutil.ToArgumentName(k[lastIndex+1:]))
 		}
 	}
 
 	ctx.Debugf("index: %d", lastIndex)
 
 	var value interface{}
+	source := fmt.Sprintf("config `%s`", k)
 
 	if lastIndex != -1 {
 		a := []rune(k)
@@ -435,22 +665,30 @@ func (p Application) GetTmplOrTypedValueForConfigKey(k string, tpe string, bindE
 		raw := p.Viper.Get(k)
 		ctx.Debugf("app fetched raw value for key %s: %v", k, raw)
 		ctx.Debugf("type of value fetched: expected %s, got %v", tpe, reflect.TypeOf(raw))
+		envVar := strings.ToUpper(k)
+		if v, ok := p.envFiles[envVar]; raw == nil && bindEnvVars && ok {
+			raw = v.Value
+			source = fmt.Sprintf("variable %s in env file %s", envVar, v.File)
+		}
 		if raw == nil {
-			return nil
+			return nil, ""
 		}
 
 		value = raw
+		if bindEnvVars && os.Getenv(envVar) != "" {
+			source = fmt.Sprintf("environment variable %s", envVar)
+		}
 	}
 
 	if value == "" {
-		return value
+		return value, source
 	} else if value != nil {
 		if v, ok := convert(value); ok {
-			return v
+			return v, source
 		}
 	}
 
-	return nil
+	return nil, ""
 }
 
 func stringToTypedValue(raw interface{}, tpe string) (interface{}, bool) {
@@ -468,6 +706,12 @@ func stringToTypedValue(raw interface{}, tpe string) (interface{}, bool) {
 				return nil, false
 			}
 			return v, true
+		case "number":
+			v, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, false
+			}
+			return v, true
 		case "bool", "boolean":
 			if s == "true" {
 				return true, true
@@ -507,6 +751,20 @@ func ensureType(raw interface{}, tpe string) (interface{}, bool) {
 		return nil, false
 	}
 
+	if tpe == "number" {
+		switch v := raw.(type) {
+		case float64:
+			return v, true
+		case float32:
+			return float64(v), true
+		case int:
+			return float64(v), true
+		case int64:
+			return float64(v), true
+		}
+		return nil, false
+	}
+
 	if tpe == "bool" {
 		switch raw.(type) {
 		case bool:
@@ -528,6 +786,13 @@ func ensureType(raw interface{}, tpe string) (interface{}, bool) {
 		case []interface{}:
 			a := []interface{}{}
 			for i := range r {
+				switch r[i].(type) {
+				case map[string]interface{}, map[interface{}]interface{}:
+				default:
+					// Scalar items like strings given via repeated flags
+					a = append(a, r[i])
+					continue
+				}
 				m, err := maputil.RecursivelyStringifyKeys(r[i])
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "unexpected error while processing array: %v", err)
@@ -570,15 +835,49 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 		return nil, errors.Errorf("%s has no task named `%s`", p.Name, taskName)
 	}
 
-	for _, input := range currentTask.ResolvedInputs {
+	if currentTask.TaskDef.BindParamsFromEnv {
+		// p is a copy, so that the variables are looked up only for this task
+		envFiles, err := p.envFileVars(taskName)
+		if err != nil {
+			return nil, err
+		}
+		p.envFiles = envFiles
+	}
+
+	// Values given via arguments, flags and configs, and their sources
+	provided := make([]interface{}, len(currentTask.ResolvedInputs))
+	sources := make([]string, len(currentTask.ResolvedInputs))
+	// Values read from stdin or files are used as-is, without being rendered as templates
+	literal := make([]bool, len(currentTask.ResolvedInputs))
+
+	var violations []inputViolation
+
+	for inputIdx, input := range currentTask.ResolvedInputs {
 		ctx.Debugf("task `%s` depends on input %s", taskName, input.ShortName())
 
+		if input.IsSecret() {
+			// Mask every value the input may take before any of them is logged while looking for the value
+			keys := []string{
+				fmt.Sprintf("%s.%s", taskName.ShortString(), input.ShortName()),
+				input.ShortName(),
+				p.TaskNamer.FromResolvedInput(input).ShortString(),
+			}
+			if baseTaskKey != "" {
+				keys = append(keys, fmt.Sprintf("%s.%s", baseTaskKey, input.ShortName()))
+			}
+			p.addSecretCandidates(input, args, arguments, keys, currentTask.TaskDef.BindParamsFromEnv)
+		}
+
 		var tmplOrStaticVal interface{}
+		var source string
 
 		if i := input.ArgumentIndex; i != nil && len(args) >= *i+1 {
 			ctx.Debugf("app found positional argument: args[%d]=%s", input.ArgumentIndex, args[*i])
 			tmplOrStaticVal = args[*i]
+			source = fmt.Sprintf("positional argument %d", *i+1)
 		}
+		// `-` and `@path` are read only from the command-line
+		fromCommandLine := tmplOrStaticVal != nil
 
 		if tmplOrStaticVal == nil {
 			if str, err := arguments.GetString(input.Name); err == nil && str != "" {
@@ -586,6 +885,7 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 				if err != nil {
 					return nil, err
 				}
+				source = fmt.Sprintf("argument `%s` given by the caller", input.Name)
 			} else {
 				errs = multierror.Append(errs, fmt.Errorf("no value for argument `%s`", input.Name))
 			}
@@ -597,44 +897,98 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 				if err != nil {
 					return nil, err
 				}
+				source = fmt.Sprintf("argument `%s` given by the caller", input.ShortName())
 			} else {
 				errs = multierror.Append(errs, fmt.Errorf("no value for argument `%s`", input.ShortName()))
 			}
 		}
 
 		confKeyBaseTask := fmt.Sprintf("%s.%s", baseTaskKey, input.ShortName())
+		confKeyTask := fmt.Sprintf("%s.%s", taskName.ShortString(), input.ShortName())
+		confKeyInput := input.ShortName()
+		inTaskName := p.TaskNamer.FromResolvedInput(input)
+
+		if tmplOrStaticVal == nil {
+			if ref, src := p.inputFlagReference(confKeyBaseTask, confKeyTask, confKeyInput, inTaskName.ShortString()); ref != "" {
+				tmplOrStaticVal, source = ref, src
+				fromCommandLine = true
+			}
+		}
+
+		if fromCommandLine && isInputValueReference(tmplOrStaticVal) {
+			v, src, err := p.readInputValueReference(input, tmplOrStaticVal.(string), source)
+			if err != nil {
+				return nil, err
+			}
+			tmplOrStaticVal, source = v, src
+			literal[inputIdx] = true
+		} else if fromCommandLine {
+			tmplOrStaticVal = unescapeInputValue(tmplOrStaticVal)
+		}
+
 		if tmplOrStaticVal == nil && baseTaskKey != "" {
-			tmplOrStaticVal = p.GetTmplOrTypedValueForConfigKey(confKeyBaseTask, input.TypeName(), currentTask.TaskDef.BindParamsFromEnv)
+			tmplOrStaticVal, source = p.tmplOrTypedValueForConfigKey(confKeyBaseTask, input.TypeName(), currentTask.TaskDef.BindParamsFromEnv)
 			if tmplOrStaticVal == nil {
 				errs = multierror.Append(errs, fmt.Errorf("no value for config `%s`", confKeyBaseTask))
 			}
 		}
 
-		confKeyTask := fmt.Sprintf("%s.%s", taskName.ShortString(), input.ShortName())
 		if tmplOrStaticVal == nil && strings.LastIndex(input.ShortName(), taskName.ShortString()) == -1 {
-			tmplOrStaticVal = p.GetTmplOrTypedValueForConfigKey(confKeyTask, input.TypeName(), currentTask.TaskDef.BindParamsFromEnv)
+			tmplOrStaticVal, source = p.tmplOrTypedValueForConfigKey(confKeyTask, input.TypeName(), currentTask.TaskDef.BindParamsFromEnv)
 			if tmplOrStaticVal == nil {
 				errs = multierror.Append(errs, fmt.Errorf("no value for config `%s`", confKeyTask))
 			}
 		}
 
-		confKeyInput := input.ShortName()
 		if tmplOrStaticVal == nil {
-			tmplOrStaticVal = p.GetTmplOrTypedValueForConfigKey(confKeyInput, input.TypeName(), currentTask.TaskDef.BindParamsFromEnv)
+			tmplOrStaticVal, source = p.tmplOrTypedValueForConfigKey(confKeyInput, input.TypeName(), currentTask.TaskDef.BindParamsFromEnv)
 			if tmplOrStaticVal == nil {
 				errs = multierror.Append(errs, fmt.Errorf("no value for config `%s`", confKeyInput))
 			}
 		}
 
-		inTaskName := p.TaskNamer.FromResolvedInput(input)
 		if tmplOrStaticVal == nil {
 			inputName := inTaskName.ShortString()
-			tmplOrStaticVal = p.GetTmplOrTypedValueForConfigKey(inputName, input.TypeName(), currentTask.TaskDef.BindParamsFromEnv)
+			tmplOrStaticVal, source = p.tmplOrTypedValueForConfigKey(inputName, input.TypeName(), currentTask.TaskDef.BindParamsFromEnv)
 			if tmplOrStaticVal == nil {
 				errs = multierror.Append(errs, fmt.Errorf("no value for config `%s`", inputName))
 			}
 		}
 
+		if tmplOrStaticVal == nil {
+			var err error
+			tmplOrStaticVal, source, err = p.inputValueForAliases(input, arguments, []string{confKeyBaseTask, confKeyTask, confKeyInput, inTaskName.ShortString()}, baseTaskKey != "", currentTask.TaskDef.BindParamsFromEnv)
+			if err != nil {
+				return nil, err
+			}
+		} else if input.Deprecated != "" && len(input.Aliases) == 0 && source != "" && !strings.HasPrefix(source, "flag ") {
+			// Deprecated flags are warned by cobra
+			ctx.Warnf("input `%s` given via %s is deprecated: %s", input.Name, source, input.Deprecated)
+		}
+
+		provided[inputIdx] = tmplOrStaticVal
+		sources[inputIdx] = source
+
+		if v := p.validateProvidedInputValue(input, tmplOrStaticVal, source); v != nil {
+			violations = append(violations, *v)
+		}
+	}
+
+	// Reject invalid values given by the user before running any task to provide other inputs
+	if len(violations) > 0 {
+		return nil, &InputValidationError{TaskName: taskName.ShortString(), Violations: violations}
+	}
+
+	order, err := inputOrderForDefaults(currentTask.ResolvedInputs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, inputIdx := range order {
+		input := currentTask.ResolvedInputs[inputIdx]
+		tmplOrStaticVal := provided[inputIdx]
+		inTaskName := p.TaskNamer.FromResolvedInput(input)
+
 		// Missed all the value sources(default, args, params, options)
 		pathComponents := strings.Split(input.Name, ".")
 		if tmplOrStaticVal == nil {
@@ -643,11 +997,26 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
+			sources[inputIdx] = fmt.Sprintf("output of task `%s`", inTaskName.ShortString())
+			if tmplOrStaticVal == nil && p.Prompter != nil && input.Required() && input.Name != "env" && p.TaskRegistry.FindTask(inTaskName) == nil {
+				// No task provides the input. Ask the user instead of failing after trying to run the missing task
+				sources[inputIdx] = "prompt"
+				tmplOrStaticVal, err = p.Prompter.Prompt(input, func(s string) (interface{}, error) {
+					return p.parseSupportedValueFromString(s, input.TypeName())
+				})
+				if err != nil {
+					return nil, err
+				}
+				maputil.SetValueAtPath(p.CachedTaskOutputs, pathComponents, tmplOrStaticVal)
+			}
 			if tmplOrStaticVal == nil {
 				args := arguments.GetSubOrEmpty(input.Name)
 				var output string
 				output, err = p.RunTask(inTaskName, []string{}, args, map[string]interface{}{}, true, currentTask)
 				if output != "" {
+					if input.IsSecret() {
+						secrets.Add(output)
+					}
 					tmplOrStaticVal = output
 				}
 				if err != nil {
@@ -656,29 +1025,37 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 					// Check if any default value is given
 					if tmplOrStaticVal == nil {
 						if input.Default != nil {
-							switch input.TypeName() {
-							case "string":
-								tmplOrStaticVal = input.DefaultAsString()
-							case "integer":
-								tmplOrStaticVal = input.DefaultAsInt()
-							case "boolean":
-								tmplOrStaticVal = input.DefaultAsBool()
-							case "array":
-								v, err := input.DefaultAsArray()
-								if err != nil {
-									return nil, errors.Wrapf(err, "failed to parse default value as array: %v", input.Default)
-								}
-								tmplOrStaticVal = v
-							case "object":
-								v, err := input.DefaultAsObject()
-								if err != nil {
-									return nil, errors.Wrapf(err, "failed to parse default value as map: %v", input.Default)
+							if tmpl, ok := input.defaultTemplate(); ok {
+								// Rendered against the inputs resolved so far, and then converted to the type of the input
+								tmplOrStaticVal = tmpl
+							} else {
+								switch input.TypeName() {
+								case "string":
+									tmplOrStaticVal = input.DefaultAsString()
+								case "integer":
+									tmplOrStaticVal = input.DefaultAsInt()
+								case "number":
+									tmplOrStaticVal = input.DefaultAsNumber()
+								case "boolean":
+									tmplOrStaticVal = input.DefaultAsBool()
+								case "array":
+									v, err := input.DefaultAsArray()
+									if err != nil {
+										return nil, errors.Wrapf(err, "failed to parse default value as array: %v", input.Default)
+									}
+									tmplOrStaticVal = v
+								case "object":
+									v, err := input.DefaultAsObject()
+									if err != nil {
+										return nil, errors.Wrapf(err, "failed to parse default value as map: %v", input.Default)
+									}
+									tmplOrStaticVal = v
+								default:
+									return nil, fmt.Errorf("unsupported input type `%s` found. the type should be one of: string, integer, number, boolean, array, object", input.TypeName())
 								}
-								tmplOrStaticVal = v
-							default:
-								return nil, fmt.Errorf("unsupported input type `%s` found. the type should be one of: string, integer, boolean", input.TypeName())
 							}
 							ctx.Debugf("got %v(%T) from default value %s(%T)", tmplOrStaticVal, tmplOrStaticVal, input.Default, input.Default)
+							sources[inputIdx] = "default value"
 						} else if input.Name == "env" {
 							tmplOrStaticVal = ""
 						} else {
@@ -710,16 +1087,30 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 		if tmplOrStaticVal != nil {
 			var renderedValue string
 			expr, ok := tmplOrStaticVal.(string)
-			if ok {
+			if ok && !literal[inputIdx] {
 				taskTemplate := NewTaskTemplate(currentTask, scope)
+				if sources[inputIdx] == "default value" {
+					taskTemplate = NewTaskTemplate(currentTask, p.defaultTemplateValues(scope, values))
+				}
 				p.Log.Debugf("rendering %s", expr)
 				r, err := taskTemplate.Render(expr, input.Name)
 				if err != nil {
+					if sources[inputIdx] == "default value" {
+						return nil, errors.Wrapf(err, "failed to render the default value of input `%s`", input.Name)
+					}
 					return nil, errors.Wrap(err, "failed to render task template")
 				}
 				renderedValue = r
+				if input.IsSecret() {
+					secrets.Add(renderedValue)
+				}
 				p.Log.Debugf("converting type of %v(%T) to %s", renderedValue, renderedValue, input.TypeName())
-				tmplOrStaticVal, err = p.parseSupportedValueFromString(renderedValue, input.TypeName())
+				if sources[inputIdx] == "default value" && input.TypeName() == "object" {
+					// Like static defaults, the rendered default is the path or URL of the file to import
+					tmplOrStaticVal, err = sourceToObject(renderedValue)
+				} else {
+					tmplOrStaticVal, err = p.parseSupportedValueFromString(renderedValue, input.TypeName())
+				}
 				if err != nil {
 					return nil, err
 				}
@@ -729,7 +1120,24 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 			// the dependent task succeeded with no output
 		}
 
+		if input.IsPath() {
+			var violation *inputViolation
+			tmplOrStaticVal, violation = resolvePathInput(input, tmplOrStaticVal, sources[inputIdx])
+			if violation != nil {
+				violations = append(violations, *violation)
+				continue
+			}
+		}
+
 		maputil.SetValueAtPath(values, pathComponents, tmplOrStaticVal)
+
+		if v := validateInputValue(input, tmplOrStaticVal, sources[inputIdx]); v != nil {
+			violations = append(violations, *v)
+		}
+	}
+
+	if len(violations) > 0 {
+		return nil, &InputValidationError{TaskName: taskName.ShortString(), Violations: violations}
 	}
 
 	ctx.WithField("values", values).Debugf("app finished collecting inputs")
@@ -737,6 +1145,36 @@ func (p Application) DirectInputValuesForTaskKey(taskName TaskName, args []strin
 	return values, nil
 }
 
+// addSecretCandidates remembers the values given to the secret input via arguments, flags, configs,
+// environment variables and the default value as secrets
+func (p Application) addSecretCandidates(input *Input, args []string, arguments task.Arguments, keys []string, bindEnvVars bool) {
+	if i := input.ArgumentIndex; i != nil && len(args) >= *i+1 {
+		secrets.Add(args[*i])
+	}
+	names := append([]string{input.Name, input.ShortName()}, input.Aliases...)
+	for _, name := range names {
+		if str, err := arguments.GetString(name); err == nil {
+			secrets.Add(str)
+		}
+	}
+	for _, k := range keys {
+		for _, alias := range input.Aliases {
+			if aliasKey := input.aliasOf(k, alias); aliasKey != "" {
+				keys = append(keys, aliasKey)
+			}
+		}
+	}
+	for _, k := range keys {
+		secrets.Add(p.inputFlagValue(fmt.Sprintf("flags.%s", k)))
+		secrets.Add(p.Viper.Get(k))
+		if bindEnvVars && !strings.Contains(k, ".") {
+			secrets.Add(os.Getenv(strings.ToUpper(k)))
+			secrets.Add(p.envFiles[strings.ToUpper(k)].Value)
+		}
+	}
+	secrets.Add(input.Default)
+}
+
 func (p *Application) parseSupportedValueFromString(renderedValue string, typeName string) (interface{}, error) {
 	switch typeName {
 	case "string":
@@ -749,6 +1187,13 @@ func (p *Application) parseSupportedValueFromString(renderedValue string, typeNa
 			return nil, errors.Wrapf(err, "%v can't be casted to integer", renderedValue)
 		}
 		return value, nil
+	case "number":
+		p.Log.Debugf("number=%v", renderedValue)
+		value, err := strconv.ParseFloat(renderedValue, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%v can't be casted to number", renderedValue)
+		}
+		return value, nil
 	case "boolean":
 		p.Log.Debugf("boolean=%v", renderedValue)
 		switch renderedValue {
@@ -776,7 +1221,7 @@ func (p *Application) parseSupportedValueFromString(renderedValue string, typeNa
 		return dst, nil
 	default:
 		p.Log.Debugf("foobar")
-		return nil, fmt.Errorf("unsupported input type `%s` found. the type should be one of: string, integer, boolean", typeName)
+		return nil, fmt.Errorf("unsupported input type `%s` found. the type should be one of: string, integer, number, boolean, array, object", typeName)
 	}
 }
 
@@ -0,0 +1,107 @@
+package variant
+
+import (
+	"bufio"
+	gocontext "context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mumoshu/variant/pkg/api/task"
+	"github.com/sirupsen/logrus"
+)
+
+func TestRunInBackgroundConcurrently(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-background")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(loaders []StepLoader) { stepLoaders = loaders }(stepLoaders)
+	Register(NewScriptStepLoader())
+	def, err := ReadTaskDefFromString(`
+tasks:
+  first:
+    script: sleep 0.2
+  second:
+    script: sleep 0.2
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def.Name = "mycmd"
+	timings, report, trace := filepath.Join(dir, "timings.json"), filepath.Join(dir, "junit.xml"), filepath.Join(dir, "trace.jsonl")
+	args := []string{"--timings-trace=" + timings, "--junit-report=" + report, "--trace-file=" + trace}
+	app, err := Init("mycmd", def, Opts{Args: args, Log: logrus.StandardLogger()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := app.VariantApp
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"first", "second"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			taskName := p.TaskNamer.FromString("mycmd." + name)
+			if _, err := p.RunInBackground(gocontext.Background(), taskName, nil, task.NewArguments(), EventSinks{}); err != nil {
+				t.Error(err)
+			}
+		}(name)
+	}
+	wg.Wait()
+	app.finish()
+
+	// Each run is a tree of its own, even though they ran at the same time
+	for _, n := range p.TimingRecorder.roots {
+		if len(n.children) != 1 || n.children[0].kind != "step" {
+			t.Errorf("unexpected timings of %s: %v", n.name, n.children)
+		}
+	}
+	if len(p.TimingRecorder.roots) != 2 {
+		t.Errorf("unexpected number of timed tasks: %d", len(p.TimingRecorder.roots))
+	}
+	xml, err := ioutil.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(xml), `<testsuite name=`) != 2 || !strings.Contains(string(xml), `tests="4"`) {
+		t.Errorf("unexpected report: %s", xml)
+	}
+
+	f, err := os.Open(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	type span struct {
+		Name        string
+		SpanContext struct{ SpanID string }
+		Parent      struct{ SpanID string }
+	}
+	names := map[string]string{}
+	var steps []span
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s span
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		names[s.SpanContext.SpanID] = s.Name
+		if s.Name == "step script" {
+			steps = append(steps, s)
+		}
+	}
+	parents := map[string]bool{}
+	for _, s := range steps {
+		parents[names[s.Parent.SpanID]] = true
+	}
+	if len(steps) != 2 || !parents["run first"] || !parents["run second"] {
+		t.Errorf("the step spans must be children of the spans of their runs: %v", parents)
+	}
+}
@@ -0,0 +1,258 @@
+package variant
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/pkg/errors"
+)
+
+// ArtifactStore stores the tarballs of artifacts, so that steps can download the artifacts uploaded by other steps
+type ArtifactStore interface {
+	Put(key string, r io.Reader) error
+	Get(key string, w io.Writer) error
+}
+
+// NewArtifactStore returns the store for the `via` of artifacts. One of `file://DIR`, `s3://BUCKET/PREFIX`, and `http(s)://URL`
+func NewArtifactStore(via string) (ArtifactStore, error) {
+	u, err := url.Parse(via)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid artifact store %s", via)
+	}
+	switch u.Scheme {
+	case "file":
+		return fileArtifactStore{dir: filepath.Join(u.Host, u.Path)}, nil
+	case "s3":
+		return newS3ArtifactStore(u.Host, strings.Trim(u.Path, "/"))
+	case "http", "https":
+		return httpArtifactStore{url: strings.TrimSuffix(via, "/"), client: http.DefaultClient}, nil
+	}
+	return nil, fmt.Errorf("unsupported artifact store %s. The scheme must be one of: file|s3|http|https", via)
+}
+
+// fileArtifactStore stores artifacts in a local directory, which may be a network file system shared among hosts
+type fileArtifactStore struct {
+	dir string
+}
+
+func (s fileArtifactStore) Put(key string, r io.Reader) error {
+	path := filepath.Join(s.dir, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (s fileArtifactStore) Get(key string, w io.Writer) error {
+	f, err := os.Open(filepath.Join(s.dir, key))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// s3ArtifactStore stores artifacts in a S3 bucket. `AWS_ENDPOINT_URL` overrides the endpoint to use a S3-compatible
+// storage like MinIO
+type s3ArtifactStore struct {
+	client   *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+	prefix   string
+}
+
+func newS3ArtifactStore(bucket, prefix string) (*s3ArtifactStore, error) {
+	config := aws.NewConfig()
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		config = config.WithEndpoint(endpoint).WithS3ForcePathStyle(true)
+		if os.Getenv("AWS_REGION") == "" && os.Getenv("AWS_DEFAULT_REGION") == "" {
+			config = config.WithRegion("us-east-1")
+		}
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{Config: *config, SharedConfigState: session.SharedConfigEnable})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create AWS session")
+	}
+	return &s3ArtifactStore{
+		client:   s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+		bucket:   bucket,
+		prefix:   prefix,
+	}, nil
+}
+
+func (s *s3ArtifactStore) key(key string) string {
+	if s.prefix == "" {
+		return key
+	}
+	return s.prefix + "/" + key
+}
+
+func (s *s3ArtifactStore) Put(key string, r io.Reader) error {
+	_, err := s.uploader.Upload(&s3manager.UploadInput{Bucket: aws.String(s.bucket), Key: aws.String(s.key(key)), Body: r})
+	return err
+}
+
+func (s *s3ArtifactStore) Get(key string, w io.Writer) error {
+	out, err := s.client.GetObject(&s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(s.key(key))})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return fmt.Errorf("s3://%s/%s does not exist", s.bucket, s.key(key))
+		}
+		return err
+	}
+	defer out.Body.Close()
+	_, err = io.Copy(w, out.Body)
+	return err
+}
+
+// httpArtifactStore stores artifacts with PUT and GET requests to URLs under the base URL, like WebDAV servers and
+// artifact repositories. Credentials can be given via the userinfo of the URL
+type httpArtifactStore struct {
+	url    string
+	client *http.Client
+}
+
+func (s httpArtifactStore) Put(key string, r io.Reader) error {
+	req, err := http.NewRequest(http.MethodPut, s.url+"/"+key, r)
+	if err != nil {
+		return err
+	}
+	if f, ok := r.(*os.File); ok {
+		// Some servers reject chunked uploads without Content-Length
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		req.ContentLength = info.Size()
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	return httpArtifactStoreError(req, res)
+}
+
+func (s httpArtifactStore) Get(key string, w io.Writer) error {
+	req, err := http.NewRequest(http.MethodGet, s.url+"/"+key, nil)
+	if err != nil {
+		return err
+	}
+	res, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err := httpArtifactStoreError(req, res); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+func httpArtifactStoreError(req *http.Request, res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	u := *req.URL
+	u.User = nil
+	return fmt.Errorf("%s %s returned %s", req.Method, u.String(), res.Status)
+}
+
+// putArtifact uploads the tarball of the artifact along with its SHA-256 checksum
+func putArtifact(store ArtifactStore, name, tarball string) error {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// The file is given as-is, so that stores can send its size
+	if err := store.Put(name+".tgz", f); err != nil {
+		return err
+	}
+	return store.Put(name+".tgz.sha256", strings.NewReader(hex.EncodeToString(hash.Sum(nil))))
+}
+
+// getArtifact downloads the tarball of the artifact to the file, after verifying its SHA-256 checksum
+func getArtifact(store ArtifactStore, name, tarball string) error {
+	var sum bytes.Buffer
+	if err := store.Get(name+".tgz.sha256", &sum); err != nil {
+		return errors.Wrapf(err, "failed to get the checksum")
+	}
+	expected := strings.TrimSpace(sum.String())
+
+	f, err := os.Create(tarball)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if err := store.Get(name+".tgz", io.MultiWriter(f, hash)); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum mismatch. expected sha256 %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// transferArtifacts tars the files of the artifacts, uploads them to their stores, and downloads them back into
+// dir after verifying them. It returns the paths to the downloaded tarballs.
+func (c RunnerConfig) transferArtifacts(dir string, context ExecutionContext) ([]string, error) {
+	var tarballs []string
+	for _, a := range c.Artifacts {
+		via, err := context.Render(a.Via, "runner.via")
+		if err != nil {
+			return nil, err
+		}
+		store, err := NewArtifactStore(via)
+		if err != nil {
+			return nil, err
+		}
+
+		local := filepath.Join(dir, a.Name+".tgz")
+		if err := createTarFromGlob(local, a.Path); err != nil {
+			return nil, errors.Wrapf(err, "failed to archive artifact %s", a.Name)
+		}
+		if err := putArtifact(store, a.Name, local); err != nil {
+			return nil, errors.Wrapf(err, "failed to upload artifact %s to %s", a.Name, via)
+		}
+
+		downloaded := filepath.Join(dir, a.Name+".downloaded.tgz")
+		if err := getArtifact(store, a.Name, downloaded); err != nil {
+			return nil, errors.Wrapf(err, "failed to download artifact %s from %s", a.Name, via)
+		}
+		tarballs = append(tarballs, downloaded)
+	}
+	return tarballs, nil
+}
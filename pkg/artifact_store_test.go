@@ -0,0 +1,80 @@
+package variant
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestArtifactStores(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-artifact-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := ioutil.ReadAll(r.Body)
+			objects[r.URL.Path] = body
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(body)
+		}
+	}))
+	defer server.Close()
+
+	tarball := filepath.Join(dir, "app.tgz")
+	if err := ioutil.WriteFile(tarball, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, via := range []string{"file://" + filepath.Join(dir, "store"), server.URL + "/artifacts"} {
+		store, err := NewArtifactStore(via)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := putArtifact(store, "app", tarball); err != nil {
+			t.Fatalf("%s: %v", via, err)
+		}
+		downloaded := filepath.Join(dir, "downloaded.tgz")
+		if err := getArtifact(store, "app", downloaded); err != nil {
+			t.Fatalf("%s: %v", via, err)
+		}
+		if content, _ := ioutil.ReadFile(downloaded); string(content) != "content" {
+			t.Errorf("%s: unexpected content: %q", via, content)
+		}
+
+		if err := store.Put("app.tgz", bytes.NewBufferString("tampered")); err != nil {
+			t.Fatal(err)
+		}
+		if err := getArtifact(store, "app", downloaded); err == nil || !strings.HasPrefix(err.Error(), "checksum mismatch") {
+			t.Errorf("%s: unexpected error: %v", via, err)
+		}
+	}
+
+	store, _ := NewArtifactStore(server.URL)
+	if err := getArtifact(store, "missing", filepath.Join(dir, "missing.tgz")); err == nil || !strings.HasSuffix(err.Error(), "/missing.tgz.sha256 returned 404 Not Found") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := NewArtifactStore("ftp://example.com"); err == nil {
+		t.Error("expected an error for the unsupported scheme")
+	}
+}
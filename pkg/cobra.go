@@ -6,7 +6,8 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
-	"github.com/spf13/viper"
+	"sort"
+	"strings"
 )
 
 type CobraAdapter struct {
@@ -95,8 +96,60 @@ func (p *CobraAdapter) Tasks() map[string]*Task {
 	return p.app.Tasks()
 }
 
-func (p *CobraAdapter) GenerateAllFlags() {
-	for _, task := range p.Tasks() {
+// inputHelpSuffix describes the allowed values and the default value of the input in the flag's help.
+// The default isn't set to the flag itself, so that the flag doesn't take precedence over configs when not given.
+func inputHelpSuffix(input *InputConfig) string {
+	var suffix string
+	if enum, ok := input.Remainings["enum"].([]interface{}); ok {
+		choices := make([]string, len(enum))
+		for i, c := range enum {
+			choices[i] = fmt.Sprintf("%v", c)
+		}
+		suffix += fmt.Sprintf(" (one of: %s)", strings.Join(choices, "|"))
+	}
+	if input.Default != nil && !input.IsSecret() {
+		suffix += fmt.Sprintf(" (default %s)", formatInputValue(input.Default))
+	}
+	return suffix
+}
+
+// reservedShorthands are the shorthands of the global flags
+var reservedShorthands = map[string]bool{"v": true, "o": true, "C": true, "c": true, "x": true, "d": true, "y": true, "h": true}
+
+// shorthandRegistry tracks the shorthands of the input flags by task, as a command can't have two flags with the
+// same shorthand including the persistent flags inherited from the parent commands
+type shorthandRegistry map[string][]TaskName
+
+func (r shorthandRegistry) add(short string, task TaskName) error {
+	if reservedShorthands[short] {
+		return fmt.Errorf("-%s is reserved for a global flag", short)
+	}
+	name := task.String()
+	for _, other := range r[short] {
+		t := other.String()
+		if t == name || strings.HasPrefix(t, name+".") || strings.HasPrefix(name, t+".") {
+			return fmt.Errorf("-%s is already used by task `%s`", short, other.ShortString())
+		}
+	}
+	r[short] = append(r[short], task)
+	return nil
+}
+
+// GenerateAllFlags adds the flags for the inputs of all the tasks. It fails when tasks conflict in the shorthands of
+// their flags.
+func (p *CobraAdapter) GenerateAllFlags() error {
+	shorthands := shorthandRegistry{}
+
+	tasks := p.Tasks()
+	// Sorted so that a parent task takes a shorthand before its children consistently
+	names := make([]string, 0, len(tasks))
+	for name := range tasks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, taskName := range names {
+		task := tasks[taskName]
 		for _, input := range task.ResolvedInputs {
 			log.Debugf("Configuring flag and config key for task %s's input: %s", task.Name.String(), input.Name)
 
@@ -108,13 +161,9 @@ func (p *CobraAdapter) GenerateAllFlags() {
 			} else {
 				description = input.Name
 			}
+			description += inputHelpSuffix(&input.InputConfig)
 
-			var name string
-			if input.TaskKey.String() == task.Name.String() {
-				name = input.Name
-			} else {
-				name = input.ShortName()
-			}
+			name := inputArgumentName(task, input)
 
 			log.Debugf("short=%s, full=%s, name=%s, selected=%s", input.ShortName(), input.FullName, input.Name, name)
 
@@ -137,9 +186,29 @@ func (p *CobraAdapter) GenerateAllFlags() {
 				log.Debugf("Binding persistent flag --%s to the config key %s", flagName, keyForConfigFromFlag)
 			}
 
-			flagset.StringP(flagName, "" /*string(input.Name[0])*/, "", description)
+			short := input.Short
+			if short != "" {
+				if err := shorthands.add(short, task.Name); err != nil {
+					return fmt.Errorf("invalid shorthand of input `%s` of task `%s`: %v", input.Name, task.Name.ShortString(), err)
+				}
+			}
 
-			viper.BindPFlag(keyForConfigFromFlag, flagset.Lookup(flagName))
+			// The flag isn't bound to viper, so that flags not given don't take precedence over configs with their zero values
+			f := addInputFlag(flagset, flagName, short, &input.InputConfig, description)
+			p.app.inputFlags[keyForConfigFromFlag] = f
+
+			for _, alias := range input.Aliases {
+				aliasFlagName := stringutil.ToArgumentName(input.aliasOf(name, alias))
+				flagset.VarPF(f.Value, aliasFlagName, "", description).NoOptDefVal = f.NoOptDefVal
+				if input.Deprecated != "" {
+					flagset.MarkDeprecated(aliasFlagName, input.Deprecated)
+				} else {
+					flagset.MarkHidden(aliasFlagName)
+				}
+			}
+			if len(input.Aliases) == 0 && input.Deprecated != "" {
+				flagset.MarkDeprecated(flagName, input.Deprecated)
+			}
 			//
 			//if input.Required() {
 			//	if len(flowConfig.TaskDefs) == 0 {
@@ -150,4 +219,5 @@ func (p *CobraAdapter) GenerateAllFlags() {
 			//}
 		}
 	}
+	return nil
 }
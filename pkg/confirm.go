@@ -0,0 +1,71 @@
+package variant
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ConfirmConfig makes a task ask the user to type the env or task name before running its steps
+type ConfirmConfig struct {
+	// Message is a template rendered with the task's inputs, shown before asking for the confirmation
+	Message string `yaml:"message,omitempty"`
+	// Envs limits the confirmation to the envs. The user types the env name instead of the task name when set.
+	Envs []string `yaml:"envs,omitempty"`
+}
+
+func (c *ConfirmConfig) GoString() string {
+	if c == nil {
+		return "nil"
+	}
+	return fmt.Sprintf("&variant.ConfirmConfig{Message:%#v, Envs:%#v}", c.Message, c.Envs)
+}
+
+// AppliesTo returns true when running the task against the env needs to be confirmed
+func (c *ConfirmConfig) AppliesTo(env string) bool {
+	if c == nil {
+		return false
+	}
+	if len(c.Envs) == 0 {
+		return true
+	}
+	return containsString(c.Envs, env)
+}
+
+// confirm asks the user to confirm running the task, unless `--yes` is given.
+// It refuses to run the task when there is no terminal to ask.
+func (p *Application) confirm(t *Task, tmpl *TaskTemplate) error {
+	c := t.Confirm
+	if !c.AppliesTo(p.Env) || p.Yes {
+		return nil
+	}
+
+	expected := t.Name.ShortString()
+	what := "task name"
+	if len(c.Envs) > 0 {
+		expected = p.Env
+		what = "env name"
+	}
+
+	message := fmt.Sprintf("You are about to run `%s` against the env `%s`.", t.Name.ShortString(), p.Env)
+	if c.Message != "" {
+		m, err := tmpl.Render(c.Message, "confirm")
+		if err != nil {
+			return errors.Wrapf(err, "failed to render the confirmation message")
+		}
+		message = m
+	}
+
+	if p.Prompter == nil {
+		return fmt.Errorf("task `%s` requires confirmation to run against the env `%s`, but there is no terminal to confirm it. Pass --yes to run it anyway", t.Name.ShortString(), p.Env)
+	}
+
+	ok, err := p.Prompter.Confirm(message, fmt.Sprintf("Type the %s `%s` to continue: ", what, expected), expected)
+	if err != nil {
+		return errors.Wrapf(err, "failed to confirm running task `%s`", t.Name.ShortString())
+	}
+	if !ok {
+		return fmt.Errorf("task `%s` was not confirmed", t.Name.ShortString())
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package variant
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestConfirm(t *testing.T) {
+	task := &Task{
+		TaskDef: TaskDef{
+			Confirm: &ConfirmConfig{
+				Message: "This destroys {{ .cluster }}!",
+				Envs:    []string{"prod"},
+			},
+		},
+		Name:        TaskName{Components: []string{"mycmd", "destroy"}},
+		ProjectName: "mycmd",
+	}
+	tmpl := NewTaskTemplate(task, map[string]interface{}{"cluster": "main"})
+
+	testcases := []struct {
+		env      string
+		yes      bool
+		typed    string
+		noTTY    bool
+		expected string
+	}{
+		{env: "dev", noTTY: true},
+		{env: "prod", typed: "prod\n"},
+		{env: "prod", typed: "destroy\n", expected: "task `destroy` was not confirmed"},
+		{env: "prod", noTTY: true, expected: "there is no terminal to confirm it"},
+		{env: "prod", noTTY: true, yes: true},
+	}
+
+	for i, tc := range testcases {
+		out := &bytes.Buffer{}
+		app := &Application{Env: tc.env, Yes: tc.yes}
+		if !tc.noTTY {
+			app.Prompter = NewInputPrompter(strings.NewReader(tc.typed), out, nil)
+		}
+
+		err := app.confirm(task, tmpl)
+
+		if tc.expected == "" && err != nil {
+			t.Errorf("case %d: unexpected error: %v", i, err)
+		} else if tc.expected != "" && (err == nil || !strings.Contains(err.Error(), tc.expected)) {
+			t.Errorf("case %d: expected error containing %q, got %v", i, tc.expected, err)
+		}
+		if !tc.noTTY && out.String() != "This destroys main!\nType the env name `prod` to continue: " {
+			t.Errorf("case %d: unexpected prompt: %q", i, out.String())
+		}
+	}
+}
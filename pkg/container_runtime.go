@@ -0,0 +1,222 @@
+package variant
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// containerRun is a container to run a script in
+type containerRun struct {
+	Image      string
+	Command    []string
+	Entrypoint *string
+	Volumes    []string
+	// Env are the variables to set in the container, sorted by the names
+	Env [][2]string
+	// PassEnv are the names of the variables to pass through from the environment of the runtime command
+	PassEnv []string
+	Envfile string
+	Net     string
+	Workdir string
+	User    string
+	// HostUser is the UID and GID of the host user, in the form of `UID:GID`, to run the container as when User is empty
+	HostUser string
+	UserNS   string
+	Pull     string
+	Platform string
+	CPUs     string
+	Memory   string
+}
+
+// containerRuntime builds the command to run a container with a container engine's CLI
+type containerRuntime interface {
+	runCommand(run containerRun) (string, []string)
+}
+
+// dockerCompatibleRuntime is a CLI accepting the flags of `docker run`, like `podman` and `nerdctl`
+type dockerCompatibleRuntime struct {
+	command string
+}
+
+func (r dockerCompatibleRuntime) runCommand(run containerRun) (string, []string) {
+	if run.User == "" {
+		run.User = run.HostUser
+	}
+	args := []string{"run", "--rm", "-i"}
+	for _, v := range run.Volumes {
+		args = append(args, "-v", v)
+	}
+	for _, kv := range run.Env {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", kv[0], kv[1]))
+	}
+	for _, k := range run.PassEnv {
+		args = append(args, "-e", k)
+	}
+	var entrypoint string
+	if run.Entrypoint != nil {
+		entrypoint = *run.Entrypoint
+	}
+	flags := [][2]string{
+		{"--env-file", run.Envfile},
+		{"--entrypoint", entrypoint},
+		{"--net", run.Net},
+		{"--workdir", run.Workdir},
+		{"--user", run.User},
+		{"--userns", run.UserNS},
+		{"--pull", run.Pull},
+		{"--platform", run.Platform},
+		{"--cpus", run.CPUs},
+		{"--memory", run.Memory},
+	}
+	for _, f := range flags {
+		if f[1] != "" {
+			args = append(args, f[0], f[1])
+		}
+	}
+	args = append(args, run.Image)
+	args = append(args, run.Command...)
+	return r.command, args
+}
+
+// podmanRuntime maps the host user with `--userns=keep-id` when rootless, as the user given via `--user` is
+// mapped to a subordinate UID on the host
+type podmanRuntime struct {
+	dockerCompatibleRuntime
+}
+
+func (r podmanRuntime) runCommand(run containerRun) (string, []string) {
+	if run.User == "" && run.HostUser != "" && !strings.HasPrefix(run.HostUser, "0:") {
+		run.UserNS = "keep-id"
+		run.HostUser = ""
+	}
+	return r.dockerCompatibleRuntime.runCommand(run)
+}
+
+var containerRuntimes = map[string]containerRuntime{
+	"docker":  dockerCompatibleRuntime{command: "docker"},
+	"podman":  podmanRuntime{dockerCompatibleRuntime{command: "podman"}},
+	"nerdctl": dockerCompatibleRuntime{command: "nerdctl"},
+}
+
+const defaultContainerRuntime = "docker"
+
+// containerRuntimeFor returns the runtime named by `runner.runtime`, or by `--container-runtime` when it's unset
+func containerRuntimeFor(name, defaultName string) (containerRuntime, error) {
+	if name == "" {
+		name = defaultName
+	}
+	if name == "" {
+		name = defaultContainerRuntime
+	}
+	r, ok := containerRuntimes[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported container runtime %q. One of: docker|podman|nerdctl", name)
+	}
+	return r, nil
+}
+
+// validateContainerOptions checks the options of the runner not checked by the container runtime before pulling the image
+func (c RunnerConfig) validateContainerOptions() error {
+	switch c.Pull {
+	case "", "always", "missing", "never":
+	default:
+		return fmt.Errorf("unsupported pull policy %q. One of: always|missing|never", c.Pull)
+	}
+	if c.User != "" && c.MapUser {
+		return fmt.Errorf("runner.user and runner.mapUser can't be set at once")
+	}
+	if c.MountCwd && c.MountWorkdir {
+		return fmt.Errorf("runner.mountCwd and runner.mountWorkdir can't be set at once")
+	}
+	return nil
+}
+
+// containerRun returns the container to run the command in
+func (c RunnerConfig) containerRun(command []string, context ExecutionContext) containerRun {
+	run := containerRun{
+		Image:      c.Image,
+		Command:    command,
+		Entrypoint: c.Entrypoint,
+		Net:        c.Net,
+		Workdir:    c.Workdir,
+		User:       c.User,
+		Pull:       c.Pull,
+		Platform:   c.Platform,
+		CPUs:       c.CPUs,
+		Memory:     c.Memory,
+	}
+
+	volumes := append(append([]string{}, c.Volumes...), context.pathInputVolumes()...)
+	if c.scriptFile != "" {
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", c.scriptFile, c.scriptFile))
+	}
+	for _, t := range c.artifactTarballs {
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", t, t))
+	}
+	for _, f := range c.consumed {
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", f, f))
+	}
+	for _, v := range volumes {
+		run.Volumes = append(run.Volumes, os.ExpandEnv(v))
+	}
+	var mount string
+	var err error
+	if c.MountCwd {
+		mount, err = os.Getwd()
+	} else if c.MountWorkdir {
+		mount, err = context.app.variantfileDir()
+	}
+	if err != nil {
+		log.Errorf("script step failed to get the directory to mount: %v", err)
+	} else if mount != "" {
+		run.Volumes = append(run.Volumes, fmt.Sprintf("%s:%s", mount, mount))
+		if run.Workdir == "" {
+			run.Workdir = mount
+		}
+	}
+
+	if c.MapUser {
+		if uid := os.Getuid(); uid >= 0 {
+			run.HostUser = fmt.Sprintf("%d:%d", uid, os.Getgid())
+		} else {
+			log.Warnf("script step ignored runner.mapUser, as the platform has no user IDs")
+		}
+	}
+
+	for _, k := range sortedKeys(c.Env) {
+		run.Env = append(run.Env, [2]string{k, os.ExpandEnv(c.Env[k])})
+	}
+	envFiles, err := context.envFileVars()
+	if err != nil {
+		log.Errorf("script step failed to load env files for the container: %v", err)
+	}
+	passed := map[string]bool{}
+	for _, k := range append(append(envFiles.names(), c.envNames...), c.PassEnv...) {
+		if _, ok := c.Env[k]; !ok && !passed[k] {
+			// Pass through the variable set to the runtime process by runCommand, not to show the value in the command
+			run.PassEnv = append(run.PassEnv, k)
+			passed[k] = true
+		}
+	}
+	if context.app.Tracing != nil {
+		// Pass through the TRACEPARENT set to the runtime process by runCommand
+		run.PassEnv = append(run.PassEnv, TraceparentEnv)
+	}
+	if c.Envfile != "" {
+		run.Envfile = os.ExpandEnv(c.Envfile)
+	}
+	return run
+}
+
+// variantfileDir returns the absolute path of the directory of the Variantfile, or the current directory when
+// the tasks are embedded in the command
+func (p Application) variantfileDir() (string, error) {
+	if p.Variantfile == "" {
+		return os.Getwd()
+	}
+	return filepath.Abs(filepath.Dir(p.Variantfile))
+}
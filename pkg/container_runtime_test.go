@@ -0,0 +1,81 @@
+package variant
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContainerRuntimeRunCommand(t *testing.T) {
+	runtime, err := containerRuntimeFor("", "podman")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entrypoint := "sh"
+	name, args := runtime.runCommand(containerRun{
+		Image:      "alpine:3.10",
+		Command:    []string{"-c", "echo hi"},
+		Entrypoint: &entrypoint,
+		Volumes:    []string{"/src:/src"},
+		Env:        [][2]string{{"A", "1"}},
+		PassEnv:    []string{"AWS_PROFILE"},
+		User:       "1000:1000",
+		Pull:       "never",
+		Platform:   "linux/arm64",
+		CPUs:       "0.5",
+		Memory:     "512m",
+	})
+	if name != "podman" {
+		t.Errorf("unexpected command: %s", name)
+	}
+	expected := []string{
+		"run", "--rm", "-i",
+		"-v", "/src:/src",
+		"-e", "A=1",
+		"-e", "AWS_PROFILE",
+		"--entrypoint", "sh",
+		"--user", "1000:1000",
+		"--pull", "never",
+		"--platform", "linux/arm64",
+		"--cpus", "0.5",
+		"--memory", "512m",
+		"alpine:3.10", "-c", "echo hi",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected args:\nexpected %q\ngot      %q", expected, args)
+	}
+
+	if _, err := containerRuntimeFor("nerdctl", "podman"); err != nil {
+		t.Errorf("runner.runtime should take precedence: %v", err)
+	}
+	if _, err := containerRuntimeFor("", "rkt"); err == nil || err.Error() != `unsupported container runtime "rkt". One of: docker|podman|nerdctl` {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (RunnerConfig{Pull: "sometimes"}).validateContainerOptions(); err == nil {
+		t.Error("expected an error for the unsupported pull policy")
+	}
+}
+
+func TestContainerRuntimeMapUser(t *testing.T) {
+	run := containerRun{Image: "alpine", HostUser: "1000:100"}
+
+	_, args := containerRuntimes["docker"].runCommand(run)
+	if expected := []string{"run", "--rm", "-i", "--user", "1000:100", "alpine"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected args for docker: %q", args)
+	}
+
+	_, args = containerRuntimes["podman"].runCommand(run)
+	if expected := []string{"run", "--rm", "-i", "--userns", "keep-id", "alpine"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected args for rootless podman: %q", args)
+	}
+
+	run.HostUser = "0:0"
+	_, args = containerRuntimes["podman"].runCommand(run)
+	if expected := []string{"run", "--rm", "-i", "--user", "0:0", "alpine"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("unexpected args for podman run by root: %q", args)
+	}
+
+	if err := (RunnerConfig{User: "1000", MapUser: true}).validateContainerOptions(); err == nil {
+		t.Error("expected an error for both user and mapUser")
+	}
+}
@@ -0,0 +1,155 @@
+package variant
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	"github.com/mumoshu/variant/pkg/util/fileutil"
+	"github.com/pkg/errors"
+)
+
+// envFileVar is a variable loaded from one of the `envFiles`
+type envFileVar struct {
+	Value string
+	File  string
+}
+
+// envFileVars are the variables loaded from `envFiles`, keyed by their names
+type envFileVars map[string]envFileVar
+
+// lookup returns the value of the variable. Variables set in the environment take precedence over env files.
+func (vs envFileVars) lookup(name string) (string, bool) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, true
+	}
+	v, ok := vs[name]
+	return v.Value, ok
+}
+
+// environ returns the variables not set in the environment, in the form of `KEY=VALUE` sorted by the keys
+func (vs envFileVars) environ() []string {
+	var env []string
+	for _, name := range vs.names() {
+		env = append(env, fmt.Sprintf("%s=%s", name, vs[name].Value))
+	}
+	return env
+}
+
+// names returns the names of the variables not set in the environment, sorted
+func (vs envFileVars) names() []string {
+	var names []string
+	for name := range vs {
+		if _, ok := os.LookupEnv(name); !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parseDotenv parses the content of a dotenv file. `${NAME}` and `$NAME` within unquoted and double-quoted values are
+// replaced with the variables defined earlier, or looked up with lookup.
+func parseDotenv(content []byte, lookup func(string) (string, bool)) ([][2]string, error) {
+	var vars [][2]string
+	defined := map[string]string{}
+	expand := func(s string) string {
+		return os.Expand(s, func(name string) string {
+			if v, ok := defined[name]; ok {
+				return v
+			}
+			v, _ := lookup(name)
+			return v
+		})
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("line %d: expected NAME=VALUE", n)
+		}
+		name := strings.TrimSpace(kv[0])
+		value := strings.TrimSpace(kv[1])
+
+		switch {
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			value = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\"`, `"`).Replace(value[1 : len(value)-1])
+			value = expand(value)
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+			value = expand(value)
+		}
+
+		defined[name] = value
+		vars = append(vars, [2]string{name, value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// envFileVars loads the `envFiles` of the app and the task's ancestors down to the task, in this order, so that
+// the files of the task override the files of the app. Paths are templates rendered with `.env`.
+// Missing files are skipped, like missing config files.
+func (p Application) envFileVars(taskName TaskName) (envFileVars, error) {
+	vars := envFileVars{}
+	for k := range taskName.Components {
+		t := p.TaskRegistry.FindTask(TaskName{Components: taskName.Components[:k+1]})
+		if t == nil {
+			continue
+		}
+		for _, f := range t.EnvFiles {
+			path, err := renderEnvFilePath(f, p.Env)
+			if err != nil {
+				return nil, err
+			}
+			if !fileutil.Exists(path) {
+				p.Log.Debugf("loading env file %s...missing", path)
+				continue
+			}
+			content, err := ioutil.ReadFile(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read env file %s", path)
+			}
+			parsed, err := parseDotenv(content, vars.lookup)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to parse env file %s", path)
+			}
+			for _, kv := range parsed {
+				vars[kv[0]] = envFileVar{Value: kv[1], File: path}
+			}
+			p.Log.Debugf("loading env file %s...done", path)
+		}
+	}
+	return vars, nil
+}
+
+func renderEnvFilePath(path, env string) (string, error) {
+	tmpl, err := template.New("envFiles").Option("missingkey=error").Funcs(sprig.HermeticTxtFuncMap()).Parse(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse env file path %s", path)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]interface{}{"env": env}); err != nil {
+		return "", errors.Wrapf(err, "failed to render env file path %s", path)
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,56 @@
+package variant
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	content := `# comment
+A=app
+export B="b-${A}\n$HOME_DIR"
+C='${A} as-is'
+D=unquoted # trailing comment
+
+E=${UNDEFINED}${FROM_LOWER_LAYER}
+`
+	lookup := func(name string) (string, bool) {
+		switch name {
+		case "HOME_DIR":
+			return "/home/app", true
+		case "FROM_LOWER_LAYER":
+			return "lower", true
+		}
+		return "", false
+	}
+
+	vars, err := parseDotenv([]byte(content), lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][2]string{
+		{"A", "app"},
+		{"B", "b-app\n/home/app"},
+		{"C", "${A} as-is"},
+		{"D", "unquoted"},
+		{"E", "lower"},
+	}
+	if !reflect.DeepEqual(vars, expected) {
+		t.Errorf("unexpected vars: expected %q, got %q", expected, vars)
+	}
+
+	if _, err := parseDotenv([]byte("A=1\nB\n"), lookup); err == nil || err.Error() != "line 2: expected NAME=VALUE" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRenderEnvFilePath(t *testing.T) {
+	path, err := renderEnvFilePath("config/environments/{{ .env }}.env", "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "config/environments/prod.env" {
+		t.Errorf("unexpected path: %s", path)
+	}
+}
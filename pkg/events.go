@@ -0,0 +1,151 @@
+package variant
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type EventType string
+
+// The event types below are part of the stable schema of the event stream written with `--events-file`.
+// Never rename or remove them. Add new ones instead.
+const (
+	EventRunStarted   EventType = "run.started"
+	EventRunFinished  EventType = "run.finished"
+	EventTaskStarted  EventType = "task.started"
+	EventTaskFinished EventType = "task.finished"
+	EventStepStarted  EventType = "step.started"
+	EventStepFinished EventType = "step.finished"
+	EventScriptStdout EventType = "script.stdout"
+	EventScriptStderr EventType = "script.stderr"
+)
+
+// Event is a line in the event stream. Fields not relevant to the event type are omitted.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	App  string    `json:"app"`
+	// Task is the dot-separated name of the task, e.g. `cluster.upgrade`. It is empty for the root task.
+	Task   string `json:"task"`
+	Caller string `json:"caller,omitempty"`
+	Step   string `json:"step,omitempty"`
+	// Args is the positional arguments given to the run
+	Args []string `json:"args,omitempty"`
+	// Inputs is the resolved inputs of the task
+	Inputs     map[string]interface{} `json:"inputs,omitempty"`
+	Output     *string                `json:"output,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	DurationMs *int64                 `json:"durationMs,omitempty"`
+	// Line is a line written by the script to stdout or stderr, without the trailing newline
+	Line string `json:"line,omitempty"`
+}
+
+func (e Event) withDurationSince(start time.Time) Event {
+	d := int64(time.Since(start) / time.Millisecond)
+	e.DurationMs = &d
+	return e
+}
+
+func (e Event) withResult(output string, err error) Event {
+	e.Output = &output
+	if err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+func (e Event) withSecretsMasked() Event {
+	if e.Args != nil {
+		e.Args = secrets.MaskValue(e.Args).([]string)
+	}
+	if e.Inputs != nil {
+		e.Inputs = secrets.MaskValue(e.Inputs).(map[string]interface{})
+	}
+	if e.Output != nil {
+		output := secrets.Mask(*e.Output)
+		e.Output = &output
+	}
+	e.Error = secrets.Mask(e.Error)
+	e.Line = secrets.Mask(e.Line)
+	return e
+}
+
+type EventSink interface {
+	Emit(e Event)
+}
+
+// EventSinks fans out events to all the sinks. Emitting to nil EventSinks is a no-op.
+type EventSinks []EventSink
+
+func (s EventSinks) Emit(e Event) {
+	if len(s) == 0 {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e = e.withSecretsMasked()
+	for _, sink := range s {
+		sink.Emit(e)
+	}
+}
+
+// Close closes all the sinks that need closing, like the events file
+func (s EventSinks) Close() error {
+	var err error
+	for _, sink := range s {
+		if c, ok := sink.(io.Closer); ok {
+			if e := c.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+// EventWriter writes events as JSON lines. A nil EventWriter discards all the events.
+type EventWriter struct {
+	mu  sync.Mutex
+	w   io.WriteCloser
+	enc *json.Encoder
+}
+
+func NewEventWriter(w io.WriteCloser) *EventWriter {
+	return &EventWriter{
+		w:   w,
+		enc: json.NewEncoder(w),
+	}
+}
+
+func OpenEventsFile(path string) (*EventWriter, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open events file")
+	}
+	return NewEventWriter(f), nil
+}
+
+func (w *EventWriter) Emit(e Event) {
+	if w == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// The event stream is a best-effort side channel. Failing to write it shouldn't fail the task.
+	w.enc.Encode(e)
+}
+
+func (w *EventWriter) Close() error {
+	if w == nil {
+		return nil
+	}
+	return w.w.Close()
+}
@@ -0,0 +1,36 @@
+package variant
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestEventWriter(t *testing.T) {
+	var nilWriter *EventWriter
+	nilWriter.Emit(Event{Type: EventRunStarted})
+	if err := nilWriter.Close(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	w := NewEventWriter(nopCloser{buf})
+
+	at := time.Date(2019, 10, 19, 0, 0, 0, 0, time.UTC)
+	w.Emit(Event{Type: EventTaskStarted, Time: at, App: "mycmd", Task: "deploy", Caller: "all"})
+	w.Emit(Event{Type: EventTaskFinished, Time: at, App: "mycmd", Task: "deploy", Inputs: map[string]interface{}{"env": "prod"}}.withResult("", fmt.Errorf("failed")))
+
+	expected := `{"type":"task.started","time":"2019-10-19T00:00:00Z","app":"mycmd","task":"deploy","caller":"all"}
+{"type":"task.finished","time":"2019-10-19T00:00:00Z","app":"mycmd","task":"deploy","inputs":{"env":"prod"},"output":"","error":"failed"}
+`
+	if buf.String() != expected {
+		t.Errorf("unexpected events:\nexpected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
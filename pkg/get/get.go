@@ -45,17 +45,24 @@ func Unmarshal(src string, dst interface{}) error {
 }
 
 func GetFileBytes(goGetterSrc string) ([]byte, error) {
+	bytes, _, err := GetFile(goGetterSrc)
+	return bytes, err
+}
+
+// GetFile returns the content of the file and its local path, which is in the cache dir for remote sources
+func GetFile(goGetterSrc string) ([]byte, string, error) {
 	// This should be shared across variant commands, so that they can share cache for the shared imports
 	cacheBaseDir := ".variant"
 
 	pwd, err := os.Getwd()
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
 	getterSrcParts := strings.Split(goGetterSrc, "//")
 	if len(getterSrcParts) != 2 {
-		return ioutil.ReadFile(goGetterSrc)
+		bytes, err := ioutil.ReadFile(goGetterSrc)
+		return bytes, goGetterSrc, err
 	}
 
 	lastIndex := len(getterSrcParts) - 1
@@ -98,10 +105,10 @@ func GetFileBytes(goGetterSrc string) ([]byte, error) {
 	{
 		stat, err := os.Stat(dst)
 		if err != nil && !os.IsNotExist(err) {
-			return nil, fmt.Errorf("stat: %v", err)
+			return nil, "", fmt.Errorf("stat: %v", err)
 		} else if err == nil {
 			if !stat.IsDir() {
-				return nil, fmt.Errorf("%s is not directory. please remove it so that variant could use it for dependency caching", dst)
+				return nil, "", fmt.Errorf("%s is not directory. please remove it so that variant could use it for dependency caching", dst)
 			}
 
 			cached = true
@@ -131,16 +138,17 @@ func GetFileBytes(goGetterSrc string) ([]byte, error) {
 		logrus.Tracef("client: %+v", *get)
 
 		if err := get.Get(); err != nil {
-			return nil, fmt.Errorf("get: %v", err)
+			return nil, "", fmt.Errorf("get: %v", err)
 		}
 
 		cancel()
 	}
 
-	bytes, err := ioutil.ReadFile(filepath.Join(dst, file))
+	path := filepath.Join(dst, file)
+	bytes, err := ioutil.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("read file: %v", err)
+		return nil, "", fmt.Errorf("read file: %v", err)
 	}
 
-	return bytes, nil
+	return bytes, path, nil
 }
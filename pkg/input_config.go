@@ -3,6 +3,7 @@ package variant
 import (
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 func Int(v int) *int {
@@ -15,6 +16,11 @@ type InputConfig struct {
 	ArgumentIndex *int                              `yaml:"argument-index,omitempty"`
 	Type          string                            `yaml:"type,omitempty"`
 	Default       interface{}                       `yaml:"default,omitempty"`
+	Secret        bool                              `yaml:"secret,omitempty"`
+	Short         string                            `yaml:"short,omitempty"`
+	Aliases       []string                          `yaml:"aliases,omitempty"`
+	Deprecated    string                            `yaml:"deprecated,omitempty"`
+	MustNotExist  bool                              `yaml:"mustNotExist,omitempty"`
 	Properties    map[string]map[string]interface{} `yaml:"properties,omitempty"`
 	Remainings    map[string]interface{}            `yaml:",inline"`
 }
@@ -34,8 +40,8 @@ func (c *InputConfig) GoString() string {
 	}
 
 	return fmt.Sprintf(
-		`&variant.InputConfig{Name:%#v, Description:%#v, ArgumentIndex:%s, Type:%#v, Default:%s, Properties:%#v, Remainings:%#v}`,
-		c.Name, c.Description, argIdx, c.Type, def, c.Properties, c.Remainings,
+		`&variant.InputConfig{Name:%#v, Description:%#v, ArgumentIndex:%s, Type:%#v, Default:%s, Secret:%#v, Short:%#v, Aliases:%#v, Deprecated:%#v, MustNotExist:%#v, Properties:%#v, Remainings:%#v}`,
+		c.Name, c.Description, argIdx, c.Type, def, c.Secret, c.Short, c.Aliases, c.Deprecated, c.MustNotExist, c.Properties, c.Remainings,
 	)
 }
 
@@ -65,6 +71,18 @@ func (c *InputConfig) DefaultAsInt() int {
 	return v
 }
 
+func (c *InputConfig) DefaultAsNumber() float64 {
+	switch v := c.Default.(type) {
+	case float64:
+		return v
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
+
 func (c *InputConfig) DefaultAsArray() ([]interface{}, error) {
 	v, ok := getOrDefault(c.Default, reflect.Slice, []interface{}{}).([]interface{})
 	if !ok {
@@ -85,9 +103,29 @@ func (c *InputConfig) DefaultAsObject() (map[string]interface{}, error) {
 	return v, nil
 }
 
+// IsSecret returns true when the value of the input must be masked in logs and outputs.
+// `type: secret` is a shorthand for `type: string` with `secret: true`.
+func (c *InputConfig) IsSecret() bool {
+	return c.Secret || c.Type == "secret"
+}
+
+// IsPath returns true for `type: file` and `type: dir`, whose values are paths given as strings
+func (c *InputConfig) IsPath() bool {
+	return c.Type == "file" || c.Type == "dir"
+}
+
+// aliasOf returns the key for the alias, given the key for the input, like `deploy.old-region` for `deploy.region`.
+// It returns an empty string when the key isn't for the input.
+func (c *InputConfig) aliasOf(key, alias string) string {
+	if !strings.HasSuffix(key, c.Name) {
+		return ""
+	}
+	return strings.TrimSuffix(key, c.Name) + alias
+}
+
 func (c *InputConfig) TypeName() string {
 	var tpe string
-	if c.Type == "" {
+	if c.Type == "" || c.Type == "secret" || c.IsPath() {
 		tpe = "string"
 	} else {
 		tpe = c.Type
@@ -108,21 +146,31 @@ func (c *InputConfig) JSONSchema() map[string]interface{} {
 }
 
 type ParameterConfig struct {
-	Name        string                            `yaml:"name,omitempty"`
-	Description string                            `yaml:"description,omitempty"`
-	Type        string                            `yaml:"type,omitempty"`
-	Default     interface{}                       `yaml:"default,omitempty"`
-	Required    bool                              `yaml:"required,omitempty"`
-	Properties  map[string]map[string]interface{} `yaml:"properties,omitempty"`
-	Remainings  map[string]interface{}            `yaml:",inline"`
+	Name         string                            `yaml:"name,omitempty"`
+	Description  string                            `yaml:"description,omitempty"`
+	Type         string                            `yaml:"type,omitempty"`
+	Default      interface{}                       `yaml:"default,omitempty"`
+	Required     bool                              `yaml:"required,omitempty"`
+	Secret       bool                              `yaml:"secret,omitempty"`
+	Short        string                            `yaml:"short,omitempty"`
+	Aliases      []string                          `yaml:"aliases,omitempty"`
+	Deprecated   string                            `yaml:"deprecated,omitempty"`
+	MustNotExist bool                              `yaml:"mustNotExist,omitempty"`
+	Properties   map[string]map[string]interface{} `yaml:"properties,omitempty"`
+	Remainings   map[string]interface{}            `yaml:",inline"`
 }
 
 type OptionConfig struct {
-	Name        string                            `yaml:"name,omitempty"`
-	Description string                            `yaml:"description,omitempty"`
-	Type        string                            `yaml:"type,omitempty"`
-	Default     interface{}                       `yaml:"default,omitempty"`
-	Required    bool                              `yaml:"required,omitempty"`
-	Properties  map[string]map[string]interface{} `yaml:"properties,omitempty"`
-	Remainings  map[string]interface{}            `yaml:",inline"`
+	Name         string                            `yaml:"name,omitempty"`
+	Description  string                            `yaml:"description,omitempty"`
+	Type         string                            `yaml:"type,omitempty"`
+	Default      interface{}                       `yaml:"default,omitempty"`
+	Required     bool                              `yaml:"required,omitempty"`
+	Secret       bool                              `yaml:"secret,omitempty"`
+	Short        string                            `yaml:"short,omitempty"`
+	Aliases      []string                          `yaml:"aliases,omitempty"`
+	Deprecated   string                            `yaml:"deprecated,omitempty"`
+	MustNotExist bool                              `yaml:"mustNotExist,omitempty"`
+	Properties   map[string]map[string]interface{} `yaml:"properties,omitempty"`
+	Remainings   map[string]interface{}            `yaml:",inline"`
 }
@@ -0,0 +1,158 @@
+package variant
+
+import (
+	"fmt"
+	"strings"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+// defaultTemplate returns the default value when it is a template like `{{ .cluster }}-{{ .env }}`, which is
+// rendered against the other inputs of the task
+func (c *InputConfig) defaultTemplate() (string, bool) {
+	s, ok := c.Default.(string)
+	return s, ok && strings.Contains(s, "{{")
+}
+
+// templateReferences returns the names of the values the template refers to via `.name` and `get "name"`
+func templateReferences(text string) ([]string, error) {
+	tree := parse.New("default")
+	tree.Mode = parse.SkipFuncCheck
+	if _, err := tree.Parse(text, "", "", map[string]*parse.Tree{}); err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Nodes {
+				walk(c)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, c := range n.Cmds {
+				walk(c)
+			}
+		case *parse.CommandNode:
+			if len(n.Args) == 2 {
+				if fn, ok := n.Args[0].(*parse.IdentifierNode); ok && fn.Ident == "get" {
+					if key, ok := n.Args[1].(*parse.StringNode); ok {
+						refs = append(refs, strings.Split(key.Text, ".")[0])
+					}
+				}
+			}
+			for _, c := range n.Args {
+				walk(c)
+			}
+		case *parse.FieldNode:
+			refs = append(refs, n.Ident[0])
+		case *parse.ChainNode:
+			walk(n.Node)
+		case *parse.VariableNode:
+			// `$.name`
+			if len(n.Ident) > 1 && n.Ident[0] == "$" {
+				refs = append(refs, n.Ident[1])
+			}
+		}
+	}
+	walk(tree.Root)
+
+	return refs, nil
+}
+
+// inputOrderForDefaults returns the indices of the inputs in the order to resolve them, so that inputs whose default
+// templates refer to other inputs of the task are resolved after them. It keeps the original order otherwise.
+func inputOrderForDefaults(inputs []*Input) ([]int, error) {
+	byName := map[string]int{}
+	for i, input := range inputs {
+		name := strings.Split(input.Name, ".")[0]
+		byName[name] = i
+		// `get` looks for `foo_bar` given `foo-bar`
+		byName[strings.Replace(name, "-", "_", -1)] = i
+	}
+
+	deps := make([][]int, len(inputs))
+	for i, input := range inputs {
+		tmpl, ok := input.defaultTemplate()
+		if !ok {
+			continue
+		}
+		refs, err := templateReferences(tmpl)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse the default value of input `%s`", input.Name)
+		}
+		for _, r := range refs {
+			if j, ok := byName[r]; ok {
+				deps[i] = append(deps[i], j)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make([]int, len(inputs))
+	order := make([]int, 0, len(inputs))
+	var path []string
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch states[i] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(path, inputs[i].Name)
+			for k, name := range cycle {
+				if name == inputs[i].Name {
+					cycle = cycle[k:]
+					break
+				}
+			}
+			return fmt.Errorf("default values of inputs refer to each other in a cycle %s", strings.Join(cycle, " -> "))
+		}
+		states[i] = visiting
+		path = append(path, inputs[i].Name)
+		for _, j := range deps[i] {
+			if err := visit(j); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		states[i] = visited
+		order = append(order, i)
+		return nil
+	}
+
+	for i := range inputs {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,46 @@
+package variant
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTemplateReferences(t *testing.T) {
+	refs, err := templateReferences(`{{ .cluster }}-{{ get "env" }}{{ if eq $.region.name "us" }}{{ .zone | upper }}{{ end }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"cluster", "env", "region", "zone"}
+	if !reflect.DeepEqual(refs, expected) {
+		t.Errorf("unexpected references: expected %v, got %v", expected, refs)
+	}
+}
+
+func TestInputOrderForDefaults(t *testing.T) {
+	input := func(name string, def interface{}) *Input {
+		return &Input{InputConfig: InputConfig{Name: name, Default: def}}
+	}
+
+	order, err := inputOrderForDefaults([]*Input{
+		input("release", "{{ .cluster }}-{{ .env }}"),
+		input("replicas", 1),
+		input("namespace", `{{ get "release" }}`),
+		input("cluster", "main"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{3, 0, 1, 2}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("unexpected order: expected %v, got %v", expected, order)
+	}
+
+	_, err = inputOrderForDefaults([]*Input{
+		input("a", "{{ .b }}"),
+		input("b", "{{ .c }}"),
+		input("c", "{{ .a }}"),
+	})
+	expected := "default values of inputs refer to each other in a cycle a -> b -> c -> a"
+	if err == nil || err.Error() != expected {
+		t.Errorf("unexpected error: expected %q, got %v", expected, err)
+	}
+}
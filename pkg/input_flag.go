@@ -0,0 +1,218 @@
+package variant
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mumoshu/variant/pkg/util/stringutil"
+	"github.com/spf13/pflag"
+)
+
+// inputFlagValue is a pflag.Value that parses the flag according to the type of the input it is generated for.
+// Array and object flags are repeatable, like `--tag a --tag b` and `--label k1=v1 --label k2=v2`.
+type inputFlagValue struct {
+	typeName string
+	values   []string
+}
+
+func newInputFlagValue(typeName string) *inputFlagValue {
+	return &inputFlagValue{typeName: typeName}
+}
+
+func (v *inputFlagValue) repeatable() bool {
+	return v.typeName == "array" || v.typeName == "object"
+}
+
+func (v *inputFlagValue) Set(s string) error {
+	if isInputValueReference(s) {
+		// The value read from stdin or the file is validated after reading it
+		v.values = []string{s}
+		return nil
+	}
+	switch v.typeName {
+	case "integer":
+		if _, err := strconv.Atoi(s); err != nil {
+			return fmt.Errorf("%q is not an integer", s)
+		}
+	case "number":
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+	case "boolean":
+		if _, err := strconv.ParseBool(s); err != nil {
+			return fmt.Errorf("%q is not a boolean", s)
+		}
+	case "object":
+		// A single value without `=` is the path or URL of a file to import, as supported before the flag became repeatable
+		if len(v.values) > 0 && (v.reference() != "" || !isKeyValue(s) || !isKeyValue(v.values[0])) {
+			return fmt.Errorf("%q must be in the form of key=value", s)
+		}
+	}
+	if v.repeatable() {
+		v.values = append(v.values, s)
+	} else {
+		v.values = []string{s}
+	}
+	return nil
+}
+
+func (v *inputFlagValue) String() string {
+	if v.repeatable() {
+		if len(v.values) == 0 {
+			return ""
+		}
+		return "[" + strings.Join(v.values, ",") + "]"
+	}
+	if len(v.values) == 0 {
+		return ""
+	}
+	return v.values[0]
+}
+
+// Type is shown in the help as the placeholder of the flag's value
+func (v *inputFlagValue) Type() string {
+	switch v.typeName {
+	case "integer":
+		return "int"
+	case "number":
+		return "float"
+	case "boolean":
+		return "bool"
+	case "array":
+		return "stringArray"
+	case "object":
+		return "key=value"
+	}
+	return "string"
+}
+
+// reference returns the value given via the flag when it is `-` or `@path` to read the actual value from
+func (v *inputFlagValue) reference() string {
+	if len(v.values) == 1 && isInputValueReference(v.values[0]) {
+		return v.values[0]
+	}
+	return ""
+}
+
+// typedValue returns the value given via the flag in the type of the input.
+// It returns nil when the value needs to be read from the reference.
+func (v *inputFlagValue) typedValue() interface{} {
+	if len(v.values) == 0 || v.reference() != "" {
+		return nil
+	}
+	s := unescapeInputValue(v.values[0]).(string)
+	switch v.typeName {
+	case "integer":
+		i, _ := strconv.Atoi(s)
+		return i
+	case "number":
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	case "boolean":
+		b, _ := strconv.ParseBool(s)
+		return b
+	case "array":
+		// A JSON array given as a single value is kept as-is to be parsed later, as supported before
+		if len(v.values) == 1 && strings.HasPrefix(strings.TrimSpace(s), "[") {
+			return s
+		}
+		a := make([]interface{}, len(v.values))
+		for i, e := range v.values {
+			a[i] = unescapeInputValue(e)
+		}
+		return a
+	case "object":
+		if len(v.values) == 1 && !isKeyValue(v.values[0]) {
+			return s
+		}
+		m := map[string]interface{}{}
+		for _, kv := range v.values {
+			pair := strings.SplitN(kv, "=", 2)
+			m[pair[0]] = pair[1]
+		}
+		return m
+	}
+	return s
+}
+
+// isKeyValue returns true when the value of an object flag is `key=value` rather than the path or URL of a file to
+// import, like `https://example.com/values.yaml?ref=main`
+func isKeyValue(s string) bool {
+	i := strings.Index(s, "=")
+	return i > 0 && !strings.ContainsAny(s[:i], "/:?")
+}
+
+// addInputFlag adds the flag typed according to the input to the flagset
+func addInputFlag(flagset *pflag.FlagSet, name, shorthand string, input *InputConfig, usage string) *pflag.Flag {
+	value := newInputFlagValue(input.TypeName())
+	f := flagset.VarPF(value, name, shorthand, usage)
+	if input.TypeName() == "boolean" {
+		// Allow `--dry-run` in addition to `--dry-run=true`
+		f.NoOptDefVal = "true"
+	}
+	return f
+}
+
+// inputArgumentName returns the name of the argument to give the value of the input to the task with. The flag
+// generated for the input is named after it in kebab case.
+func inputArgumentName(task *Task, input *Input) string {
+	if input.TaskKey.String() == task.Name.String() {
+		return input.Name
+	}
+	return input.ShortName()
+}
+
+// ArgumentsFromFlags returns the arguments to run the task with for the values of the flags generated for its inputs,
+// like `cluster-name` for the input `cluster_name`, keyed by the flag names without `--`. It fails on flags the task
+// doesn't have.
+func (p *Application) ArgumentsFromFlags(taskName TaskName, flags map[string]string) (map[string]interface{}, error) {
+	t := p.TaskRegistry.FindTask(taskName)
+	if t == nil {
+		return nil, fmt.Errorf("no task named `%s` exists", taskName.ShortString())
+	}
+	names := map[string]string{}
+	for _, input := range t.ResolvedInputs {
+		name := inputArgumentName(t, input)
+		names[stringutil.ToArgumentName(name)] = name
+		for _, alias := range input.Aliases {
+			if a := input.aliasOf(name, alias); a != "" {
+				names[stringutil.ToArgumentName(a)] = name
+			}
+		}
+	}
+	arguments := map[string]interface{}{}
+	for flag, v := range flags {
+		name, ok := names[flag]
+		if !ok {
+			return nil, fmt.Errorf("unknown flag: --%s", flag)
+		}
+		arguments[name] = v
+	}
+	return arguments, nil
+}
+
+// inputFlagValue returns the value given via the flag bound to the config key, or any of its aliases.
+// It falls back to the config, including environment variables, when the flag isn't given.
+func (p Application) inputFlagValue(key string) interface{} {
+	if f, ok := p.inputFlags[key]; ok {
+		// The value is shared with the alias flags. Check it instead of whether the flag was changed
+		if v := f.Value.(*inputFlagValue).typedValue(); v != nil {
+			return v
+		}
+	}
+	return p.Viper.Get(key)
+}
+
+// inputFlagReference returns the first `-` or `@path` given via the flags bound to the config keys, along with
+// the source of the value
+func (p Application) inputFlagReference(keys ...string) (string, string) {
+	for _, k := range keys {
+		if f, ok := p.inputFlags[fmt.Sprintf("flags.%s", k)]; ok {
+			if ref := f.Value.(*inputFlagValue).reference(); ref != "" {
+				return ref, fmt.Sprintf("flag --%s", f.Name)
+			}
+		}
+	}
+	return "", ""
+}
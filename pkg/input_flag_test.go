@@ -0,0 +1,172 @@
+package variant
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+func TestInputFlags(t *testing.T) {
+	flagset := pflag.NewFlagSet("deploy", pflag.ContinueOnError)
+
+	flags := map[string]*pflag.Flag{}
+	for _, input := range []*InputConfig{
+		{Name: "dry-run", Type: "boolean"},
+		{Name: "replicas", Type: "integer"},
+		{Name: "ratio", Type: "number"},
+		{Name: "tags", Type: "array"},
+		{Name: "labels", Type: "object"},
+		{Name: "values", Type: "object"},
+		{Name: "region"},
+		{Name: "zone"},
+	} {
+		flags[input.Name] = addInputFlag(flagset, input.Name, input.Short, input, input.Name)
+	}
+
+	err := flagset.Parse([]string{
+		"--dry-run", "--replicas", "3", "--ratio", "0.75",
+		"--tags", "a", "--tags", "b",
+		"--labels", "k1=v1", "--labels", "k2=v=2",
+		"--values", "values.yaml",
+		"--region", "eu-west-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]interface{}{
+		"dry-run":  true,
+		"replicas": 3,
+		"ratio":    0.75,
+		"tags":     []interface{}{"a", "b"},
+		"labels":   map[string]interface{}{"k1": "v1", "k2": "v=2"},
+		"values":   "values.yaml",
+		"region":   "eu-west-1",
+		"zone":     nil,
+	}
+	for name, e := range expected {
+		f := flags[name]
+		if f.Changed != (e != nil) {
+			t.Errorf("unexpected changed of --%s: %v", name, f.Changed)
+		}
+		if v := f.Value.(*inputFlagValue).typedValue(); !reflect.DeepEqual(v, e) {
+			t.Errorf("unexpected value of --%s: expected %#v, got %#v", name, e, v)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"--replicas", "three"},
+		{"--ratio", "half"},
+		{"--dry-run=maybe"},
+		{"--labels", "k1=v1", "--labels", "k2"},
+	} {
+		if err := flagset.Parse(args); err == nil {
+			t.Errorf("parsing %v must fail", args)
+		}
+	}
+}
+
+func TestInputFlagAliases(t *testing.T) {
+	flagset := pflag.NewFlagSet("deploy", pflag.ContinueOnError)
+
+	input := &InputConfig{Name: "region", Short: "r", Aliases: []string{"aws-region"}}
+	f := addInputFlag(flagset, "region", input.Short, input, "region")
+	flagset.VarPF(f.Value, input.aliasOf("region", "aws-region"), "", "region")
+
+	if err := flagset.Parse([]string{"--aws-region", "eu-west-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if v := f.Value.(*inputFlagValue).typedValue(); v != "eu-west-1" {
+		t.Errorf("unexpected value of --region given via its alias: %#v", v)
+	}
+
+	if err := flagset.Parse([]string{"-r", "us-east-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if v := f.Value.(*inputFlagValue).typedValue(); v != "us-east-1" {
+		t.Errorf("unexpected value of --region given via its shorthand: %#v", v)
+	}
+
+	if k := input.aliasOf("deploy.region", "aws-region"); k != "deploy.aws-region" {
+		t.Errorf("unexpected config key for the alias: %s", k)
+	}
+}
+
+func TestShorthandRegistry(t *testing.T) {
+	r := shorthandRegistry{}
+
+	if err := r.add("r", TaskName{Components: []string{"deploy"}}); err != nil {
+		t.Fatal(err)
+	}
+	// Sibling commands can share shorthands
+	if err := r.add("r", TaskName{Components: []string{"destroy"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		short string
+		task  []string
+	}{
+		{"r", []string{"deploy"}},
+		{"r", []string{"deploy", "app"}},
+		{"v", []string{"build"}},
+	} {
+		if err := r.add(c.short, TaskName{Components: c.task}); err == nil {
+			t.Errorf("expected -%s of task %v to conflict", c.short, c.task)
+		}
+	}
+}
+
+func TestGenerateAllFlagsShorthandConflict(t *testing.T) {
+	registry := NewTaskRegistry()
+	for _, name := range []string{"deploy", "deploy.app"} {
+		taskName := TaskName{Components: strings.Split("mycmd."+name, ".")}
+		registry.put(taskName, &Task{
+			Name:    taskName,
+			Command: &cobra.Command{Use: name},
+			ResolvedInputs: []*Input{{
+				InputConfig: InputConfig{Name: "region", Short: "r"},
+				TaskKey:     taskName,
+				FullName:    name + ".region",
+			}},
+		})
+	}
+
+	for i := 0; i < 10; i++ {
+		app := &Application{TaskRegistry: registry, inputFlags: map[string]*pflag.Flag{}}
+		for _, task := range registry.Tasks() {
+			task.Command = &cobra.Command{Use: task.Name.Simple()}
+		}
+		err := NewCobraAdapter(app).GenerateAllFlags()
+		if err == nil || err.Error() != "invalid shorthand of input `region` of task `deploy.app`: -r is already used by task `deploy`" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestInputFlagObjectImports(t *testing.T) {
+	for value, expected := range map[string]interface{}{
+		"https://example.com/cfg.yaml?ref=main":              "https://example.com/cfg.yaml?ref=main",
+		"git::https://example.com/repo.git//cfg.yaml?ref=v1": "git::https://example.com/repo.git//cfg.yaml?ref=v1",
+		"configs/a=b.yaml":             "configs/a=b.yaml",
+		"env=prod":                     map[string]interface{}{"env": "prod"},
+		"url=https://example.com/?a=b": map[string]interface{}{"url": "https://example.com/?a=b"},
+	} {
+		flagset := pflag.NewFlagSet("deploy", pflag.ContinueOnError)
+		f := addInputFlag(flagset, "config", "", &InputConfig{Name: "config", Type: "object"}, "config")
+		if err := flagset.Parse([]string{"--config", value}); err != nil {
+			t.Fatal(err)
+		}
+		if v := f.Value.(*inputFlagValue).typedValue(); !reflect.DeepEqual(v, expected) {
+			t.Errorf("unexpected value of --config %s: %#v", value, v)
+		}
+	}
+
+	flagset := pflag.NewFlagSet("deploy", pflag.ContinueOnError)
+	addInputFlag(flagset, "config", "", &InputConfig{Name: "config", Type: "object"}, "config")
+	if err := flagset.Parse([]string{"--config", "https://example.com/cfg.yaml?ref=main", "--config", "env=prod"}); err == nil {
+		t.Error("expected an error for the URL mixed with key=value")
+	}
+}
@@ -0,0 +1,140 @@
+package variant
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mumoshu/variant/pkg/util/maputil"
+)
+
+// maxFileInputContentSize is the size of the largest file whose content is exposed to templates as `.files.NAME.content`
+const maxFileInputContentSize = 1024 * 1024
+
+// resolvePathInput turns the path given to a `file` or `dir` input into the absolute path, resolving the relative path
+// against the directory variant is run in, and checks that the file or directory is there and readable.
+// With `mustNotExist`, it checks that nothing is there but the parent directory is.
+func resolvePathInput(input *Input, v interface{}, source string) (interface{}, *inputViolation) {
+	path, ok := v.(string)
+	if !input.IsPath() || !ok || path == "" {
+		return v, nil
+	}
+
+	violation := func(format string, args ...interface{}) *inputViolation {
+		return &inputViolation{Input: input.Name, Got: v, Source: source, Secret: input.IsSecret(), Reasons: []string{fmt.Sprintf(format, args...)}}
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, violation("%v", err)
+	}
+
+	info, err := os.Stat(abs)
+	if input.MustNotExist {
+		if err == nil {
+			return nil, violation("%s already exists", abs)
+		}
+		if parent, err := os.Stat(filepath.Dir(abs)); err != nil || !parent.IsDir() {
+			return nil, violation("directory %s does not exist", filepath.Dir(abs))
+		}
+		return abs, nil
+	}
+	if os.IsNotExist(err) {
+		return nil, violation("%s %s does not exist", input.Type, abs)
+	}
+	if err != nil {
+		return nil, violation("%v", err)
+	}
+
+	switch {
+	case input.Type == "file" && info.IsDir():
+		return nil, violation("%s is a directory, not a file", abs)
+	case input.Type == "dir" && !info.IsDir():
+		return nil, violation("%s is not a directory", abs)
+	}
+
+	f, err := os.Open(abs)
+	if err != nil {
+		return nil, violation("%s is not readable: %v", abs, err)
+	}
+	f.Close()
+
+	return abs, nil
+}
+
+// pathInputs returns the `file` and `dir` inputs of the task and its parent tasks
+func (p Application) pathInputs(taskName TaskName) []*Input {
+	var inputs []*Input
+	for k := range taskName.Components {
+		t := p.TaskRegistry.FindTask(TaskName{Components: taskName.Components[:k+1]})
+		if t == nil {
+			continue
+		}
+		for _, input := range t.ResolvedInputs {
+			if input.IsPath() {
+				inputs = append(inputs, input)
+			}
+		}
+	}
+	return inputs
+}
+
+func pathInputValue(input *Input, vars map[string]interface{}) string {
+	v, err := maputil.GetValueAtPath(vars, strings.Split(input.Name, "."))
+	if err != nil {
+		return ""
+	}
+	s, _ := v.(string)
+	return s
+}
+
+// fileInputTemplateValues returns the values exposed to templates as `.files`, like `.files.kubeconfig.path` and
+// `.files.kubeconfig.content`. The content is read only for files up to maxFileInputContentSize.
+func (p Application) fileInputTemplateValues(taskName TaskName, vars map[string]interface{}) (map[string]interface{}, error) {
+	files := map[string]interface{}{}
+	for _, input := range p.pathInputs(taskName) {
+		path := pathInputValue(input, vars)
+		if path == "" {
+			continue
+		}
+		file := map[string]interface{}{"path": path}
+		if input.Type == "file" && !input.MustNotExist {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if info.Size() <= maxFileInputContentSize {
+				content, err := ioutil.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
+				if input.IsSecret() {
+					secrets.Add(string(content))
+				}
+				file["content"] = string(content)
+			}
+		}
+		maputil.SetValueAtPath(files, strings.Split(input.Name, "."), file)
+	}
+	return files, nil
+}
+
+// pathInputVolumes returns the docker volumes to mount the files and directories given to the task's `file` and
+// `dir` inputs at the same paths within the container, so that the paths rendered into the script work as-is.
+// The parent directory is mounted for `mustNotExist` inputs so that the script can create the file or directory.
+func (c ExecutionContext) pathInputVolumes() []string {
+	var volumes []string
+	for _, input := range c.app.pathInputs(c.taskRunner.Task.Name) {
+		path := pathInputValue(input, c.Values())
+		if path == "" {
+			continue
+		}
+		if input.MustNotExist {
+			path = filepath.Dir(path)
+		}
+		volumes = append(volumes, fmt.Sprintf("%s:%s", path, path))
+	}
+	return volumes
+}
@@ -0,0 +1,66 @@
+package variant
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePathInput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-input-path")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "values.yaml")
+	if err := ioutil.WriteFile(file, []byte("replicas: 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	values := &Input{InputConfig: InputConfig{Name: "values", Type: "file"}}
+	chart := &Input{InputConfig: InputConfig{Name: "chart", Type: "dir"}}
+	out := &Input{InputConfig: InputConfig{Name: "out", Type: "file", MustNotExist: true}}
+
+	for _, tc := range []struct {
+		input    *Input
+		value    string
+		expected string
+		reason   string
+	}{
+		{values, "values.yaml", file, ""},
+		{values, file, file, ""},
+		{values, "missing.yaml", "", "file " + filepath.Join(dir, "missing.yaml") + " does not exist"},
+		{values, ".", "", dir + " is a directory, not a file"},
+		{chart, ".", dir, ""},
+		{chart, "values.yaml", "", file + " is not a directory"},
+		{out, "out.yaml", filepath.Join(dir, "out.yaml"), ""},
+		{out, "values.yaml", "", file + " already exists"},
+		{out, "missing/out.yaml", "", "directory " + filepath.Join(dir, "missing") + " does not exist"},
+	} {
+		v, violation := resolvePathInput(tc.input, tc.value, "flag --"+tc.input.Name)
+		if tc.reason == "" {
+			if violation != nil {
+				t.Errorf("unexpected violation for %s %q: %v", tc.input.Type, tc.value, violation.Reasons)
+			} else if v != tc.expected {
+				t.Errorf("unexpected path for %s %q: expected %q, got %q", tc.input.Type, tc.value, tc.expected, v)
+			}
+			continue
+		}
+		if violation == nil {
+			t.Errorf("expected %s %q to be invalid", tc.input.Type, tc.value)
+		} else if len(violation.Reasons) != 1 || violation.Reasons[0] != tc.reason {
+			t.Errorf("unexpected reasons for %s %q: expected %q, got %q", tc.input.Type, tc.value, tc.reason, violation.Reasons)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package variant
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/mumoshu/variant/pkg/get"
+	"github.com/pkg/errors"
+)
+
+// stdinReference is the flag or argument value to read the input's value from stdin
+const stdinReference = "-"
+
+// stdinReader reads stdin for the first input referencing it, so that the second one fails instead of getting an empty value
+var stdinReader = struct {
+	sync.Mutex
+	readBy string
+}{}
+
+// isInputValueReference returns true when the value given via a flag or an argument is `-` or `@path`, so that the
+// actual value needs to be read from stdin or the file. `@@` escapes a value starting with `@`.
+func isInputValueReference(v interface{}) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	return s == stdinReference || (strings.HasPrefix(s, "@") && !strings.HasPrefix(s, "@@") && len(s) > 1)
+}
+
+// unescapeInputValue turns `@@foo` into `@foo`
+func unescapeInputValue(v interface{}) interface{} {
+	if s, ok := v.(string); ok && strings.HasPrefix(s, "@@") {
+		return s[1:]
+	}
+	return v
+}
+
+func readStdinForInput(name string) ([]byte, error) {
+	stdinReader.Lock()
+	defer stdinReader.Unlock()
+	if stdinReader.readBy != "" {
+		return nil, fmt.Errorf("stdin is already read for input `%s`", stdinReader.readBy)
+	}
+	stdinReader.readBy = name
+	return ioutil.ReadAll(os.Stdin)
+}
+
+// readInputValueReference reads the value of the input from stdin or the file referenced by ref, and parses it
+// according to the input's type. Arrays and objects are parsed as YAML or JSON, like the files given to objects.
+// It returns the source to be shown in validation errors, like "file manifest.json given via flag --manifest".
+func (p *Application) readInputValueReference(input *Input, ref string, source string) (interface{}, string, error) {
+	var content []byte
+	var err error
+	if ref == stdinReference {
+		content, err = readStdinForInput(input.Name)
+		source = fmt.Sprintf("stdin given via %s", source)
+	} else {
+		path := strings.TrimPrefix(ref, "@")
+		content, err = get.GetFileBytes(path)
+		source = fmt.Sprintf("file %s given via %s", path, source)
+	}
+	if err != nil {
+		return nil, source, errors.Wrapf(err, "failed to read the value of input `%s` from %s", input.Name, source)
+	}
+
+	s := string(content)
+	if input.IsSecret() {
+		secrets.Add(s)
+	}
+
+	tpe := input.TypeName()
+	if tpe != "array" && tpe != "object" {
+		// Ignore the newline at the end of the file, as in `echo mytoken | var login --token -`
+		s = strings.TrimSuffix(strings.TrimSuffix(s, "\n"), "\r")
+	}
+
+	v, err := p.parseSupportedValueFromString(s, tpe)
+	if err != nil {
+		return nil, source, errors.Wrapf(err, "failed to parse the value of input `%s` from %s", input.Name, source)
+	}
+	return v, source, nil
+}
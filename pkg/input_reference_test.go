@@ -0,0 +1,100 @@
+package variant
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+func TestReadInputValueReference(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-input-reference")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	app := &Application{Log: logrus.New()}
+
+	for _, tc := range []struct {
+		typeName string
+		content  string
+		expected interface{}
+	}{
+		{"string", "has {{ braces }}\n", "has {{ braces }}"},
+		{"integer", "3\n", 3},
+		{"number", "0.5", 0.5},
+		{"boolean", "true\r\n", true},
+		{"array", "- a\n- b\n", []interface{}{"a", "b"}},
+		{"object", `{"kind": "Pod", "spec": {"replicas": 2}}`, map[string]interface{}{"kind": "Pod", "spec": map[string]interface{}{"replicas": 2}}},
+	} {
+		input := &Input{InputConfig: InputConfig{Name: "manifest", Type: tc.typeName}}
+		path := write(tc.typeName, tc.content)
+		v, source, err := app.readInputValueReference(input, "@"+path, "flag --manifest")
+		if err != nil {
+			t.Errorf("unexpected error for %s: %v", tc.typeName, err)
+			continue
+		}
+		if !reflect.DeepEqual(v, tc.expected) {
+			t.Errorf("unexpected value for %s: expected %#v, got %#v", tc.typeName, tc.expected, v)
+		}
+		if expected := "file " + path + " given via flag --manifest"; source != expected {
+			t.Errorf("unexpected source for %s: expected %q, got %q", tc.typeName, expected, source)
+		}
+	}
+
+	stdin := os.Stdin
+	defer func() {
+		os.Stdin = stdin
+		stdinReader.readBy = ""
+	}()
+	os.Stdin, err = os.Open(write("stdin", "mytoken\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := &Input{InputConfig: InputConfig{Name: "token"}}
+	v, source, err := app.readInputValueReference(token, "-", "positional argument 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "mytoken" || source != "stdin given via positional argument 1" {
+		t.Errorf("unexpected value from stdin: %#v from %s", v, source)
+	}
+	if _, _, err := app.readInputValueReference(&Input{InputConfig: InputConfig{Name: "other"}}, "-", "flag --other"); err == nil {
+		t.Errorf("expected reading stdin twice to fail")
+	}
+}
+
+func TestInputFlagReference(t *testing.T) {
+	flagset := pflag.NewFlagSet("apply", pflag.ContinueOnError)
+
+	replicas := addInputFlag(flagset, "replicas", "", &InputConfig{Name: "replicas", Type: "integer"}, "replicas")
+	handle := addInputFlag(flagset, "handle", "", &InputConfig{Name: "handle"}, "handle")
+
+	if err := flagset.Parse([]string{"--replicas", "@replicas.txt", "--handle", "@@team"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ref := replicas.Value.(*inputFlagValue).reference(); ref != "@replicas.txt" {
+		t.Errorf("unexpected reference: %q", ref)
+	}
+	if v := replicas.Value.(*inputFlagValue).typedValue(); v != nil {
+		t.Errorf("unexpected value of the flag referencing a file: %#v", v)
+	}
+	if v := handle.Value.(*inputFlagValue).typedValue(); v != "@team" {
+		t.Errorf("unexpected value of the escaped flag: %#v", v)
+	}
+}
@@ -0,0 +1,157 @@
+package variant
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// inputViolation describes why the value of an input is invalid, in terms of what the user can fix
+type inputViolation struct {
+	Input string
+	Got   interface{}
+	// Source tells where the value came from, like `flag --region` or `config deploy.region`. Empty when unknown.
+	Source  string
+	Allowed []interface{}
+	Reasons []string
+	Secret  bool
+}
+
+// InputValidationError aggregates all the invalid inputs of a task
+type InputValidationError struct {
+	TaskName   string
+	Violations []inputViolation
+}
+
+func formatInputValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+func (e *InputValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid inputs for task `%s`\n", e.TaskName)
+	for _, v := range e.Violations {
+		got := formatInputValue(v.Got)
+		if v.Secret {
+			got = secretMask
+		}
+		fmt.Fprintf(&b, "- %s got %s", v.Input, got)
+		if v.Source != "" {
+			fmt.Fprintf(&b, " from %s", v.Source)
+		}
+		b.WriteString("\n")
+		if len(v.Allowed) > 0 {
+			allowed := make([]string, len(v.Allowed))
+			for i, a := range v.Allowed {
+				allowed[i] = formatInputValue(a)
+			}
+			fmt.Fprintf(&b, "    allowed values are %s\n", strings.Join(allowed, ", "))
+		}
+		for _, r := range v.Reasons {
+			fmt.Fprintf(&b, "    %s\n", r)
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func newInputViolation(input *InputConfig, got interface{}, source string, errs []gojsonschema.ResultError) *inputViolation {
+	v := &inputViolation{
+		Input:  input.Name,
+		Got:    got,
+		Source: source,
+		Secret: input.IsSecret(),
+	}
+	if enum, ok := input.Remainings["enum"].([]interface{}); ok {
+		v.Allowed = enum
+	}
+	for _, e := range errs {
+		// Allowed values are listed on their own
+		if e.Type() == "enum" && len(v.Allowed) > 0 {
+			continue
+		}
+		v.Reasons = append(v.Reasons, e.Description())
+	}
+	return v
+}
+
+// validateInputValue validates the value of the input against the input's JSON Schema.
+// Nil values are left to the validation of the whole inputs, as inputs may be provided by tasks with no output.
+func validateInputValue(input *Input, v interface{}, source string) *inputViolation {
+	if v == nil {
+		return nil
+	}
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(input.JSONSchema()))
+	if err != nil {
+		return &inputViolation{Input: input.Name, Got: v, Source: source, Secret: input.IsSecret(), Reasons: []string{err.Error()}}
+	}
+	result, err := schema.Validate(gojsonschema.NewGoLoader(v))
+	if err != nil {
+		return &inputViolation{Input: input.Name, Got: v, Source: source, Secret: input.IsSecret(), Reasons: []string{err.Error()}}
+	}
+	if result.Valid() {
+		return nil
+	}
+	return newInputViolation(&input.InputConfig, v, source, result.Errors())
+}
+
+// validateProvidedInputValue validates the value given via an argument, a flag or a config before it is rendered.
+// Values containing templates are validated after rendering.
+func (p Application) validateProvidedInputValue(input *Input, v interface{}, source string) *inputViolation {
+	s, ok := v.(string)
+	if ok && strings.Contains(s, "{{") {
+		return nil
+	}
+	if ok && input.TypeName() != "string" {
+		parsed, err := p.parseSupportedValueFromString(s, input.TypeName())
+		if err != nil {
+			return &inputViolation{Input: input.Name, Got: v, Source: source, Secret: input.IsSecret(), Reasons: []string{err.Error()}}
+		}
+		v = parsed
+	}
+	if _, violation := resolvePathInput(input, v, source); violation != nil {
+		return violation
+	}
+	return validateInputValue(input, v, source)
+}
+
+// inputViolationsFromResult converts the result of validating all the inputs of a task into violations per input
+func inputViolationsFromResult(inputs []*InputConfig, vars map[string]interface{}, result *gojsonschema.Result) []inputViolation {
+	errsByField := map[string][]gojsonschema.ResultError{}
+	for _, e := range result.Errors() {
+		field := e.Field()
+		if e.Type() == "required" {
+			if p, ok := e.Details()["property"].(string); ok {
+				field = p
+			}
+		}
+		errsByField[field] = append(errsByField[field], e)
+	}
+
+	fields := make([]string, 0, len(errsByField))
+	for f := range errsByField {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	var violations []inputViolation
+	for _, f := range fields {
+		input := &InputConfig{Name: f}
+		for _, in := range inputs {
+			if in != nil && in.Name == strings.SplitN(f, ".", 2)[0] {
+				input = in
+			}
+		}
+		violations = append(violations, *newInputViolation(input, vars[input.Name], "", errsByField[f]))
+	}
+	return violations
+}
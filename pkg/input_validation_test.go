@@ -0,0 +1,60 @@
+package variant
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestInputValidation(t *testing.T) {
+	region := &Input{InputConfig: InputConfig{
+		Name:       "region",
+		Remainings: map[string]interface{}{"enum": []interface{}{"us-east-1", "eu-west-1"}},
+	}}
+	replicas := &Input{InputConfig: InputConfig{
+		Name:       "replicas",
+		Type:       "integer",
+		Remainings: map[string]interface{}{"minimum": 1},
+	}}
+	token := &Input{InputConfig: InputConfig{
+		Name:       "token",
+		Type:       "secret",
+		Remainings: map[string]interface{}{"minLength": 8},
+	}}
+
+	app := Application{Log: logrus.New()}
+
+	var violations []inputViolation
+	for _, tc := range []struct {
+		input  *Input
+		value  interface{}
+		source string
+	}{
+		{region, "ap-south-1", "flag --region"},
+		{region, "us-east-1", "flag --region"},
+		{replicas, "0", "positional argument 1"},
+		{replicas, "many", "config `deploy.replicas`"},
+		{replicas, "{{ .count }}", "config `deploy.replicas`"},
+		{token, "short", "environment variable TOKEN"},
+	} {
+		if v := app.validateProvidedInputValue(tc.input, tc.value, tc.source); v != nil {
+			violations = append(violations, *v)
+		}
+	}
+
+	err := &InputValidationError{TaskName: "deploy", Violations: violations}
+
+	expected := `invalid inputs for task ` + "`deploy`" + `
+- region got "ap-south-1" from flag --region
+    allowed values are "us-east-1", "eu-west-1"
+- replicas got 0 from positional argument 1
+    Must be greater than or equal to 1
+- replicas got "many" from config ` + "`deploy.replicas`" + `
+    many can't be casted to integer: strconv.Atoi: parsing "many": invalid syntax
+- token got *** from environment variable TOKEN
+    String length must be greater than or equal to 8`
+
+	if err.Error() != expected {
+		t.Errorf("unexpected error:\nexpected:\n%s\ngot:\n%s", expected, err.Error())
+	}
+}
@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SubmitRequest is the body of `POST /runs`
+type SubmitRequest struct {
+	Task      string                 `json:"task"`
+	Args      []string               `json:"args,omitempty"`
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+}
+
+// Handler returns the HTTP API to submit and manage runs, which responds to:
+//
+//	POST /runs               submits a run with the SubmitRequest in the body, responding with the run
+//	GET  /runs               lists the runs in the order of submission
+//	GET  /runs/<id>          responds with the run
+//	GET  /runs/<id>/logs     responds with the log of the run. With `?follow=true`, it streams the log until the run finishes
+//	POST /runs/<id>/cancel   requests the run to be cancelled
+//
+// Runs and errors are written as JSON, and logs as plain text.
+func (j *Jobs) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/runs", j.handleRuns)
+	mux.HandleFunc("/runs/", j.handleRun)
+	return mux
+}
+
+func (j *Jobs) handleRuns(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		runs, err := j.List()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if runs == nil {
+			runs = []*Run{}
+		}
+		writeJSON(w, http.StatusOK, runs)
+	case http.MethodPost:
+		var body SubmitRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %v", err))
+			return
+		}
+		r, err := j.Submit(body.Task, body.Args, body.Arguments)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", req.Method))
+	}
+}
+
+func (j *Jobs) handleRun(w http.ResponseWriter, req *http.Request) {
+	path := strings.Split(strings.TrimPrefix(req.URL.Path, "/runs/"), "/")
+	id, action := path[0], ""
+	if len(path) > 1 {
+		action = strings.Join(path[1:], "/")
+	}
+
+	// IDs are used as names of the directories of runs, so only the ones that can't point to other directories exist
+	if id == "" || strings.ContainsAny(id, `.\`) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no run with id %q exists", id))
+		return
+	}
+	r, err := j.Get(id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	switch {
+	case action == "" && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, r)
+	case action == "logs" && req.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		// Errors after the log is partially written can't be reported to the client
+		j.Logs(req.Context(), id, req.URL.Query().Get("follow") == "true", &flushWriter{w: w})
+	case action == "cancel" && req.Method == http.MethodPost:
+		if err := j.Cancel(id); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, r)
+	case action == "" || action == "logs" || action == "cancel":
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", req.Method))
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown path %s", req.URL.Path))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// flushWriter sends what is written to the client right away, so that followed logs are streamed
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,114 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	variant "github.com/mumoshu/variant/pkg"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	variant.Register(variant.NewScriptStepLoader())
+	def, err := variant.ReadTaskDefFromString(`
+tasks:
+  greet:
+    inputs:
+    - name: name
+      type: string
+    script: |
+      echo "hello {{ .name }}"
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def.Name = "mycmd"
+	app, err := variant.Init("mycmd", def, variant.Opts{Args: []string{}, Log: logrus.StandardLogger()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := New(app.VariantApp, NewStore(dir))
+
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- j.Serve(ctx, 1, 10*time.Millisecond)
+	}()
+	defer func() {
+		stop()
+		if err := <-served; err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	server := httptest.NewServer(j.Handler())
+	defer server.Close()
+
+	request := func(method, path, body string, status int) string {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != status {
+			t.Fatalf("unexpected status of %s %s: %d: %s", method, path, res.StatusCode, data)
+		}
+		return string(data)
+	}
+
+	var submitted Run
+	if err := json.Unmarshal([]byte(request("POST", "/runs", `{"task":"greet","arguments":{"name":"world"}}`, http.StatusCreated)), &submitted); err != nil {
+		t.Fatal(err)
+	}
+
+	// The log is streamed until the run finishes
+	if logs := request("GET", "/runs/"+submitted.ID+"/logs?follow=true", "", http.StatusOK); logs != "hello world\n" {
+		t.Errorf("unexpected logs: %q", logs)
+	}
+	var r Run
+	if err := json.Unmarshal([]byte(request("GET", "/runs/"+submitted.ID, "", http.StatusOK)), &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != StatusSucceeded || r.Output != "hello world" {
+		t.Errorf("unexpected run: %+v", r)
+	}
+	var runs []Run
+	if err := json.Unmarshal([]byte(request("GET", "/runs", "", http.StatusOK)), &runs); err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].ID != submitted.ID {
+		t.Errorf("unexpected runs: %+v", runs)
+	}
+
+	if res := request("POST", "/runs/"+submitted.ID+"/cancel", "", http.StatusConflict); !strings.Contains(res, "has already finished") {
+		t.Errorf("unexpected response: %s", res)
+	}
+	if res := request("POST", "/runs", `{"task":"nonexistent"}`, http.StatusBadRequest); !strings.Contains(res, "no task named `nonexistent` exists") {
+		t.Errorf("unexpected response: %s", res)
+	}
+	request("GET", "/runs/..%5C..%5Cetc", "", http.StatusNotFound)
+	request("GET", "/runs/nonexistent", "", http.StatusNotFound)
+	request("DELETE", "/runs/"+submitted.ID, "", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,223 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	variant "github.com/mumoshu/variant/pkg"
+	"github.com/mumoshu/variant/pkg/api/task"
+	log "github.com/sirupsen/logrus"
+)
+
+// Jobs is the Go API to submit tasks of the app as runs and to manage them. The runs are persisted in the store, and
+// executed in-process with Application.RunTask by Serve, which may be called in another process sharing the store.
+type Jobs struct {
+	app   *variant.Application
+	store *Store
+}
+
+func New(app *variant.Application, store *Store) *Jobs {
+	return &Jobs{app: app, store: store}
+}
+
+func (j *Jobs) taskName(task string) variant.TaskName {
+	return j.app.TaskNamer.FromString(fmt.Sprintf("%s.%s", j.app.Name, task))
+}
+
+// Submit queues a run of the task against the env of the app. task is the dot-separated name of the task like
+// `cluster.upgrade`, args are its positional arguments, and arguments are the values of its inputs keyed by their names.
+func (j *Jobs) Submit(task string, args []string, arguments map[string]interface{}) (*Run, error) {
+	if j.app.TaskRegistry.FindTask(j.taskName(task)) == nil {
+		return nil, fmt.Errorf("no task named `%s` exists", task)
+	}
+	r, err := NewRun(task, j.app.Env, args, arguments)
+	if err != nil {
+		return nil, err
+	}
+	if err := j.store.Save(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ArgumentsFromFlags returns the arguments to submit the task with for the values given via the flags generated for its
+// inputs, keyed by the flag names without `--`. It fails on flags the task doesn't have.
+func (j *Jobs) ArgumentsFromFlags(task string, flags map[string]string) (map[string]interface{}, error) {
+	return j.app.ArgumentsFromFlags(j.taskName(task), flags)
+}
+
+// List returns all the runs in the order of submission
+func (j *Jobs) List() ([]*Run, error) {
+	return j.store.List()
+}
+
+func (j *Jobs) Get(id string) (*Run, error) {
+	return j.store.Get(id)
+}
+
+// Logs writes the log of the run to w. With follow, it keeps writing the log until the run finishes or ctx is done.
+func (j *Jobs) Logs(ctx context.Context, id string, follow bool, w io.Writer) error {
+	r, err := j.store.Get(id)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(j.store.LogPath(id))
+	// The log is created once the run is started
+	for follow && os.IsNotExist(err) && !r.Status.Finished() {
+		if err := sleep(ctx, 500*time.Millisecond); err != nil {
+			return err
+		}
+		if r, err = j.store.Get(id); err != nil {
+			return err
+		}
+		f, err = os.Open(j.store.LogPath(id))
+	}
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for {
+		if _, err := io.Copy(w, f); err != nil {
+			return err
+		}
+		if !follow || r.Status.Finished() {
+			return nil
+		}
+		if err := sleep(ctx, 500*time.Millisecond); err != nil {
+			return err
+		}
+		// Read the status before copying the rest, so that the log written right before the run finished isn't missed
+		r, err = j.store.Get(id)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// Cancel requests the queued or running run to be cancelled by the process serving it
+func (j *Jobs) Cancel(id string) error {
+	r, err := j.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if r.Status.Finished() {
+		return fmt.Errorf("run %s has already finished: %s", r.ID, r.Status)
+	}
+	return j.store.RequestCancel(r.ID)
+}
+
+// Serve executes the runs submitted against the env of the app with up to the number of workers at once, until ctx
+// is done. It then waits for the runs being executed to finish.
+func (j *Jobs) Serve(ctx context.Context, workers int, pollInterval time.Duration) error {
+	servelog := log.WithField("runs", "serve")
+
+	q := NewQueue(j.store, workers, j.execute)
+	q.Start()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	servelog.Infof("serving runs against the env %s in %s with %d workers", j.app.Env, j.store.Dir(), workers)
+
+	for {
+		runs, err := j.store.List()
+		if err != nil {
+			servelog.Errorf("failed to list runs: %v", err)
+		}
+		for _, r := range runs {
+			if r.Status == StatusRunning {
+				if err := j.reap(r); err != nil {
+					servelog.Errorf("failed to reap run %s: %v", r.ID, err)
+				}
+			}
+			// The inputs of the task are resolved with the config of the env the app is loaded with
+			if r.Status.Finished() || r.Env != j.app.Env {
+				continue
+			}
+			if j.store.CancelRequested(r.ID) {
+				if r.Status == StatusQueued {
+					q.Enqueue(r)
+				}
+				if err := q.Cancel(r.ID); err != nil {
+					servelog.Debugf("%v", err)
+				}
+			} else if r.Status == StatusQueued {
+				q.Enqueue(r)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			servelog.Infof("waiting for running runs to finish")
+			q.Stop()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// reap fails the run when the process running it has exited before the run finished, which is when its lock isn't
+// held. Runs of live processes, including this one, are left as-is.
+func (j *Jobs) reap(r *Run) error {
+	lock, ok, err := j.store.lockRun(r.ID)
+	if err != nil || !ok {
+		return err
+	}
+	defer lock.Close()
+	// The run may have finished before the lock was taken
+	latest, err := j.store.Get(r.ID)
+	if err != nil || latest.Status != StatusRunning {
+		return err
+	}
+	owner := "the process"
+	if latest.Owner != nil {
+		owner = latest.Owner.String()
+	}
+	now := time.Now()
+	latest.Status = StatusFailed
+	latest.Error = fmt.Sprintf("interrupted: %s running this exited before the run finished", owner)
+	latest.FinishedAt = &now
+	*r = *latest
+	return j.store.Save(r)
+}
+
+// execute runs the task of the run in-process, writing the stdout and stderr lines of the scripts to the log
+func (j *Jobs) execute(ctx context.Context, r *Run, w io.Writer) (string, error) {
+	arguments := task.NewArguments()
+	if r.Arguments != nil {
+		arguments = task.NewArguments(r.Arguments)
+	}
+	return j.app.RunInBackground(ctx, j.taskName(r.Task), r.Args, arguments, &logSink{w: w})
+}
+
+// logSink writes the stdout and stderr lines of the scripts of a run to its log
+type logSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *logSink) Emit(e variant.Event) {
+	if e.Type != variant.EventScriptStdout && e.Type != variant.EventScriptStderr {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintln(s.w, e.Line)
+}
@@ -0,0 +1,164 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	variant "github.com/mumoshu/variant/pkg"
+	"github.com/sirupsen/logrus"
+)
+
+func TestJobs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	variant.Register(variant.NewScriptStepLoader())
+	def, err := variant.ReadTaskDefFromString(`
+tasks:
+  greet:
+    inputs:
+    - name: name
+      type: string
+    - name: who
+      argument-index: 0
+      type: string
+    script: |
+      echo "greeting {{ .name }}" >&2
+      echo "hello {{ .name }} from {{ .who }}"
+  upgrade:
+    inputs:
+    - name: cluster_name
+      type: string
+    - name: version
+      type: string
+      default: latest
+    script: |
+      echo "upgrading {{ .cluster_name }} to {{ .version }}"
+  slow:
+    script: |
+      sleep 30
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def.Name = "mycmd"
+	app, err := variant.Init("mycmd", def, variant.Opts{Args: []string{}, Log: logrus.StandardLogger()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := New(app.VariantApp, NewStore(dir))
+
+	// Runs left running by processes that exited, and by a live process holding the lock of the run
+	store := NewStore(dir)
+	orphaned, _ := NewRun("greet", "dev", nil, nil)
+	orphaned.Status, orphaned.Owner = StatusRunning, &Owner{Host: "old", PID: 1}
+	owned, _ := NewRun("greet", "dev", nil, nil)
+	owned.Status = StatusRunning
+	for _, r := range []*Run{orphaned, owned} {
+		if err := store.Save(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lock, ok, err := store.lockRun(owned.ID)
+	if err != nil || !ok {
+		t.Fatalf("failed to lock: %v", err)
+	}
+	defer lock.Close()
+
+	ctx, stop := context.WithCancel(context.Background())
+	served := make(chan error)
+	go func() {
+		served <- j.Serve(ctx, 2, 10*time.Millisecond)
+	}()
+
+	waitFor := func(id string, status Status) *Run {
+		t.Helper()
+		for i := 0; i < 500; i++ {
+			r, err := j.Get(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Status == status {
+				return r
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("run %s never got %s", id, status)
+		return nil
+	}
+
+	r := waitFor(orphaned.ID, StatusFailed)
+	if r.Error != "interrupted: process 1 on old running this exited before the run finished" {
+		t.Errorf("unexpected error: %s", r.Error)
+	}
+
+	greet, err := j.Submit("greet", []string{"you"}, map[string]interface{}{"name": "world"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = waitFor(greet.ID, StatusSucceeded)
+	if r.Output != "hello world from you" {
+		t.Errorf("unexpected output: %q", r.Output)
+	}
+	var logs bytes.Buffer
+	if err := j.Logs(ctx, greet.ID, true, &logs); err != nil {
+		t.Fatal(err)
+	}
+	// stdout and stderr are read concurrently, so the lines may be in any order
+	for _, line := range []string{"greeting world\n", "hello world from you\n"} {
+		if !strings.Contains(logs.String(), line) {
+			t.Errorf("%q is missing in the logs: %q", line, logs.String())
+		}
+	}
+
+	// Inputs are given via the flags generated for them, like `--cluster-name` for `cluster_name`
+	arguments, err := j.ArgumentsFromFlags("upgrade", map[string]string{"cluster-name": "prod", "version": "1.15"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upgrade, err := j.Submit("upgrade", nil, arguments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := waitFor(upgrade.ID, StatusSucceeded); r.Output != "upgrading prod to 1.15" {
+		t.Errorf("unexpected output: %q", r.Output)
+	}
+	if _, err := j.ArgumentsFromFlags("upgrade", map[string]string{"cluster_name": "prod"}); err == nil || err.Error() != "unknown flag: --cluster_name" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	slow, err := j.Submit("slow", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(slow.ID, StatusRunning)
+	if err := j.Cancel(slow.ID); err != nil {
+		t.Fatal(err)
+	}
+	// The script is killed instead of being waited for
+	waitFor(slow.ID, StatusCancelled)
+	if err := j.Cancel(slow.ID); err == nil || !strings.Contains(err.Error(), "has already finished") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := j.Submit("nonexistent", nil, nil); err == nil || err.Error() != "no task named `nonexistent` exists" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if r, err := j.Get(owned.ID); err != nil || r.Status != StatusRunning {
+		t.Errorf("the run of the live process must not be reaped: %v, %v", r, err)
+	}
+
+	stop()
+	if err := <-served; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,23 @@
+package jobs
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// tryLock takes the exclusive lock of the file at path without blocking. It returns false when the lock is held by
+// another process, or via another open file in this process. The lock is released by closing the returned file, or
+// by the OS when the process exits, so that the locks of processes that crashed never get stale.
+func tryLock(path string) (*os.File, bool, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "opening lock %s", path)
+	}
+	locked, err := tryLockFile(f)
+	if err != nil || !locked {
+		f.Close()
+		return nil, false, errors.Wrapf(err, "locking %s", path)
+	}
+	return f, true, nil
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTryLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "lock")
+	lock, ok, err := tryLock(path)
+	if err != nil || !ok {
+		t.Fatalf("expected the lock to be taken: %v", err)
+	}
+	// Another open file conflicts with the lock, like the one of another process
+	if _, ok, err := tryLock(path); err != nil || ok {
+		t.Fatalf("expected the lock to be held: %v", err)
+	}
+	lock.Close()
+	lock, ok, err = tryLock(path)
+	if err != nil || !ok {
+		t.Fatalf("expected the released lock to be taken: %v", err)
+	}
+	lock.Close()
+}
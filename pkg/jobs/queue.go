@@ -0,0 +1,272 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ExecuteFunc runs the task of the run until it finishes or the ctx is cancelled, and returns the output of the task.
+// Anything written to the writer is persisted as the log of the run.
+type ExecuteFunc func(ctx context.Context, r *Run, w io.Writer) (string, error)
+
+// Queue executes submitted runs with a bounded number of workers.
+// Runs sharing the same concurrency key are never executed at once, including by the queues of other processes
+// sharing the store. The later one waits in the queue until the earlier one finishes.
+type Queue struct {
+	store   *Store
+	workers int
+	execute ExecuteFunc
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*Run
+	known   map[string]bool
+	active  map[string]bool
+	cancels map[string]context.CancelFunc
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func NewQueue(store *Store, workers int, execute ExecuteFunc) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &Queue{
+		store:   store,
+		workers: workers,
+		execute: execute,
+		known:   map[string]bool{},
+		active:  map[string]bool{},
+		cancels: map[string]context.CancelFunc{},
+	}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *Queue) Start() {
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Stop stops accepting runs and waits for the runs being executed to finish. Pending runs are left queued in the store
+// so that they are picked up on the next start.
+func (q *Queue) Stop() {
+	q.mu.Lock()
+	q.stopped = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// Submit persists the run and queues it for execution
+func (q *Queue) Submit(r *Run) error {
+	r.Status = StatusQueued
+	if err := q.store.Save(r); err != nil {
+		return err
+	}
+	q.Enqueue(r)
+	return nil
+}
+
+// Enqueue queues a run that has already been persisted, e.g. by another process via `runs submit`.
+// Runs that are already known to the queue are ignored.
+func (q *Queue) Enqueue(r *Run) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.known[r.ID] {
+		// Let the workers retry the runs waiting for the locks held by other processes
+		q.cond.Broadcast()
+		return
+	}
+	q.known[r.ID] = true
+	q.pending = append(q.pending, r)
+	q.cond.Broadcast()
+}
+
+// Cancel cancels the run. A pending run is removed from the queue, and a running run is interrupted.
+func (q *Queue) Cancel(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if cancel, ok := q.cancels[id]; ok {
+		cancel()
+		return nil
+	}
+
+	for i, r := range q.pending {
+		if r.ID == id {
+			lock, ok, err := q.store.lockRun(id)
+			if err != nil {
+				return err
+			} else if !ok {
+				return fmt.Errorf("run %q is being run by another process", id)
+			}
+			defer lock.Close()
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			now := time.Now()
+			r.Status = StatusCancelled
+			r.FinishedAt = &now
+			q.cond.Broadcast()
+			return q.store.Save(r)
+		}
+	}
+
+	return fmt.Errorf("run %q is neither queued nor running", id)
+}
+
+// Wait blocks until the run finishes and returns its final state
+func (q *Queue) Wait(id string) (*Run, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		r, err := q.store.Get(id)
+		if err != nil {
+			return nil, err
+		}
+		if r.Status.Finished() {
+			return r, nil
+		}
+		q.cond.Wait()
+	}
+}
+
+// next returns the first pending run whose concurrency key isn't held by a running run, along with the func to
+// release the locks of the run. It returns nil once the queue is stopped.
+func (q *Queue) next() (*Run, func()) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		if q.stopped {
+			return nil, nil
+		}
+		for i := 0; i < len(q.pending); i++ {
+			r := q.pending[i]
+			key := r.ConcurrencyKey()
+			if q.active[key] {
+				continue
+			}
+			release, ok, drop := q.lock(r)
+			if drop {
+				q.pending = append(q.pending[:i], q.pending[i+1:]...)
+				i--
+			}
+			if !ok {
+				continue
+			}
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			q.active[key] = true
+			return r, release
+		}
+		q.cond.Wait()
+	}
+}
+
+// lock takes the locks of the concurrency key and the run. It returns false when another process holds either of
+// them, with drop set when the run has been run by another process and is no longer to be run by this queue.
+func (q *Queue) lock(r *Run) (release func(), ok, drop bool) {
+	runlog := log.WithFields(log.Fields{"run": r.ID, "task": r.Task, "env": r.Env})
+
+	keyLock, ok, err := q.store.lockKey(r.ConcurrencyKey())
+	if err != nil {
+		runlog.Errorf("%v", err)
+	}
+	if !ok {
+		return nil, false, false
+	}
+	runLock, ok, err := q.store.lockRun(r.ID)
+	if err != nil {
+		runlog.Errorf("%v", err)
+	}
+	if !ok {
+		keyLock.Close()
+		return nil, false, err == nil
+	}
+	// Another process may have run or cancelled it before the lock was taken
+	if latest, err := q.store.Get(r.ID); err != nil || latest.Status != StatusQueued {
+		runLock.Close()
+		keyLock.Close()
+		return nil, false, true
+	}
+	return func() {
+		runLock.Close()
+		keyLock.Close()
+	}, true, false
+}
+
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for {
+		r, release := q.next()
+		if r == nil {
+			return
+		}
+		q.run(r, release)
+	}
+}
+
+// run executes the run, and calls release once the run is finished and saved
+func (q *Queue) run(r *Run, release func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runlog := log.WithFields(log.Fields{"run": r.ID, "task": r.Task, "env": r.Env})
+
+	q.mu.Lock()
+	q.cancels[r.ID] = cancel
+	q.mu.Unlock()
+
+	defer func() {
+		release()
+		q.mu.Lock()
+		delete(q.cancels, r.ID)
+		delete(q.active, r.ConcurrencyKey())
+		q.cond.Broadcast()
+		q.mu.Unlock()
+	}()
+
+	started := time.Now()
+	r.Owner = currentOwner()
+	r.Status = StatusRunning
+	r.StartedAt = &started
+	if err := q.store.Save(r); err != nil {
+		runlog.Errorf("failed to save run: %v", err)
+	}
+
+	runlog.Infof("starting run %s", r.ID)
+
+	var out string
+	logfile, err := q.store.OpenLog(r.ID)
+	if err == nil {
+		out, err = q.execute(ctx, r, logfile)
+		logfile.Close()
+	}
+
+	finished := time.Now()
+	r.FinishedAt = &finished
+	r.Output = strings.Trim(out, "\n ")
+	switch {
+	case ctx.Err() != nil:
+		r.Status = StatusCancelled
+	case err != nil:
+		r.Status = StatusFailed
+		r.Error = err.Error()
+	default:
+		r.Status = StatusSucceeded
+	}
+
+	runlog.Infof("finished run %s: %s", r.ID, r.Status)
+
+	q.mu.Lock()
+	if err := q.store.Save(r); err != nil {
+		runlog.Errorf("failed to save run: %v", err)
+	}
+	q.mu.Unlock()
+}
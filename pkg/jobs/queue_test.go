@@ -0,0 +1,146 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-jobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewStore(dir)
+
+	var mu sync.Mutex
+	running := map[string]int{}
+	maxRunning := map[string]int{}
+
+	q := NewQueue(store, 3, func(ctx context.Context, r *Run, log io.Writer) (string, error) {
+		key := r.ConcurrencyKey()
+		mu.Lock()
+		running[key]++
+		if running[key] > maxRunning[key] {
+			maxRunning[key] = running[key]
+		}
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			running[key]--
+			mu.Unlock()
+		}()
+
+		fmt.Fprintf(log, "running %s\n", r.Task)
+
+		switch r.Task {
+		case "block":
+			<-ctx.Done()
+			return "", ctx.Err()
+		case "fail":
+			return "", fmt.Errorf("simulated error")
+		}
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(log, "deployed\n")
+		return fmt.Sprintf("%s on %s\n", r.Task, r.Env), nil
+	})
+	q.Start()
+	defer q.Stop()
+
+	submit := func(task, env string) *Run {
+		r, err := NewRun(task, env, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Submit(r); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	deploys := []*Run{
+		submit("deploy", "prod"),
+		submit("deploy", "prod"),
+		submit("deploy", "dev"),
+	}
+	failing := submit("fail", "prod")
+	blocking := submit("block", "prod")
+
+	for _, d := range deploys {
+		r, err := q.Wait(d.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Status != StatusSucceeded {
+			t.Errorf("unexpected status of %s: %s", r.ID, r.Status)
+		}
+		if expected := fmt.Sprintf("deploy on %s", r.Env); r.Output != expected {
+			t.Errorf("unexpected output of %s: expected %q, got %q", r.ID, expected, r.Output)
+		}
+		log, err := ioutil.ReadFile(store.LogPath(r.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "running deploy\ndeployed\n"; string(log) != expected {
+			t.Errorf("unexpected log of %s: expected %q, got %q", r.ID, expected, string(log))
+		}
+	}
+
+	if maxRunning["deploy@prod"] != 1 {
+		t.Errorf("runs with the same concurrency key must not run at once: %d were run at once", maxRunning["deploy@prod"])
+	}
+
+	r, err := q.Wait(failing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != StatusFailed || r.Error != "simulated error" {
+		t.Errorf("unexpected result of failing run: status=%s, error=%s", r.Status, r.Error)
+	}
+
+	if err := q.Cancel(blocking.ID); err != nil {
+		t.Fatal(err)
+	}
+	r, err = q.Wait(blocking.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != StatusCancelled {
+		t.Errorf("unexpected status of cancelled run: %s", r.Status)
+	}
+
+	// Another process running the task against the env holds the lock of the concurrency key
+	held, ok, err := store.lockKey("deploy@staging")
+	if err != nil || !ok {
+		t.Fatalf("failed to lock: %v", err)
+	}
+	staging := submit("deploy", "staging")
+	time.Sleep(50 * time.Millisecond)
+	if r, err := store.Get(staging.ID); err != nil || r.Status != StatusQueued {
+		t.Errorf("run must wait for the lock held by another process: %v, %v", r, err)
+	}
+	held.Close()
+	q.Enqueue(staging)
+	r, err = q.Wait(staging.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Status != StatusSucceeded || r.Owner == nil || r.Owner.PID != os.Getpid() {
+		t.Errorf("unexpected run: %+v", r)
+	}
+
+	runs, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 6 {
+		t.Errorf("unexpected number of runs: %d", len(runs))
+	}
+}
@@ -0,0 +1,95 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCancelled Status = "cancelled"
+)
+
+// Finished returns true when the run reached a terminal status and will never be updated again
+func (s Status) Finished() bool {
+	switch s {
+	case StatusSucceeded, StatusFailed, StatusCancelled:
+		return true
+	}
+	return false
+}
+
+// Run is a single submission of a task, persisted as `run.json` under the run directory of the store
+type Run struct {
+	ID   string `json:"id"`
+	Task string `json:"task"`
+	Env  string `json:"env"`
+	// Args are the positional arguments of the task
+	Args []string `json:"args,omitempty"`
+	// Arguments are the values of the inputs of the task keyed by their names, like the ones given via flags
+	Arguments map[string]interface{} `json:"arguments,omitempty"`
+
+	// Owner is the process running the run. It's unset until the run is started
+	Owner *Owner `json:"owner,omitempty"`
+
+	Status      Status     `json:"status"`
+	Output      string     `json:"output,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	SubmittedAt time.Time  `json:"submittedAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Owner is the process running a run
+type Owner struct {
+	Host string `json:"host"`
+	PID  int    `json:"pid"`
+}
+
+func currentOwner() *Owner {
+	host, _ := os.Hostname()
+	return &Owner{Host: host, PID: os.Getpid()}
+}
+
+func (o *Owner) String() string {
+	return fmt.Sprintf("process %d on %s", o.PID, o.Host)
+}
+
+// ConcurrencyKey identifies runs that must not be run at once. Two runs of the same task against the same env
+// are serialized by the queue.
+func (r *Run) ConcurrencyKey() string {
+	return fmt.Sprintf("%s@%s", r.Task, r.Env)
+}
+
+func NewRun(task, env string, args []string, arguments map[string]interface{}) (*Run, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	return &Run{
+		ID:          id,
+		Task:        task,
+		Env:         env,
+		Args:        args,
+		Arguments:   arguments,
+		Status:      StatusQueued,
+		SubmittedAt: time.Now(),
+	}, nil
+}
+
+// newID generates a run ID prefixed with the submission time, so that it is easy to tell when the run was submitted
+func newID() (string, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating run id: %v", err)
+	}
+	return fmt.Sprintf("%s-%s", time.Now().UTC().Format("20060102-150405"), hex.EncodeToString(b)), nil
+}
@@ -0,0 +1,133 @@
+package jobs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultDir is where runs are persisted unless specified otherwise.
+// It lives next to the `.variant` cache used for imports, so that all the state variant creates is in one place.
+const DefaultDir = ".variant/runs"
+
+const (
+	runFile    = "run.json"
+	logFile    = "log"
+	cancelFile = "cancel"
+	lockFile   = "lock"
+)
+
+// Store persists runs and their logs in a local directory. Each run gets its own sub-directory named after its ID.
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) runDir(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+func (s *Store) Save(r *Run) error {
+	d := s.runDir(r.ID)
+	if err := os.MkdirAll(d, 0755); err != nil {
+		return errors.Wrapf(err, "creating run dir %s", d)
+	}
+	bs, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "marshalling run %s", r.ID)
+	}
+	// Write to a temporary file and then rename it, so that a concurrent reader never sees a partially written run
+	tmp := filepath.Join(d, runFile+".tmp")
+	if err := ioutil.WriteFile(tmp, bs, 0644); err != nil {
+		return errors.Wrapf(err, "writing run %s", r.ID)
+	}
+	return os.Rename(tmp, filepath.Join(d, runFile))
+}
+
+func (s *Store) Get(id string) (*Run, error) {
+	bs, err := ioutil.ReadFile(filepath.Join(s.runDir(id), runFile))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no run with id %q exists", id)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "reading run %s", id)
+	}
+	r := &Run{}
+	if err := json.Unmarshal(bs, r); err != nil {
+		return nil, errors.Wrapf(err, "parsing run %s", id)
+	}
+	return r, nil
+}
+
+// List returns all the runs in the order of submission
+func (s *Store) List() ([]*Run, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return []*Run{}, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "listing runs in %s", s.dir)
+	}
+	runs := []*Run{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		r, err := s.Get(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].SubmittedAt.Before(runs[j].SubmittedAt)
+	})
+	return runs, nil
+}
+
+// lockRun takes the lock of the run, which is held by the process running it until the run finishes
+func (s *Store) lockRun(id string) (*os.File, bool, error) {
+	return tryLock(filepath.Join(s.runDir(id), lockFile))
+}
+
+// lockKey takes the lock of the concurrency key, so that the runs sharing it are never run at once by the processes
+// sharing the store
+func (s *Store) lockKey(key string) (*os.File, bool, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, false, errors.Wrapf(err, "creating runs dir %s", s.dir)
+	}
+	return tryLock(filepath.Join(s.dir, url.PathEscape(key)+".lock"))
+}
+
+func (s *Store) LogPath(id string) string {
+	return filepath.Join(s.runDir(id), logFile)
+}
+
+func (s *Store) OpenLog(id string) (*os.File, error) {
+	return os.OpenFile(s.LogPath(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+}
+
+// RequestCancel marks the run to be cancelled by whichever process is running the queue.
+// A marker file is used instead of updating run.json so that it never races with status updates made by the queue.
+func (s *Store) RequestCancel(id string) error {
+	if _, err := s.Get(id); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(s.runDir(id), cancelFile), []byte{}, 0644)
+}
+
+func (s *Store) CancelRequested(id string) bool {
+	_, err := os.Stat(filepath.Join(s.runDir(id), cancelFile))
+	return err == nil
+}
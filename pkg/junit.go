@@ -0,0 +1,254 @@
+package variant
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+	SystemErr *junitOutput  `xml:"system-err,omitempty"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+func newJUnitOutput(b *strings.Builder) *junitOutput {
+	if b.Len() == 0 {
+		return nil
+	}
+	return &junitOutput{Text: xmlText(b.String())}
+}
+
+var ansiEscapes = regexp.MustCompile("\x1b\\[[0-9;?]*[ -/]*[@-~]")
+
+// xmlText removes ANSI escape sequences like colors, and replaces the other characters not allowed in XML 1.0 with
+// U+FFFD, as CDATA is written without escaping
+func xmlText(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+		case r >= 0x20 && r <= 0xD7FF:
+		case r >= 0xE000 && r <= 0xFFFD:
+		case r >= 0x10000 && r <= 0x10FFFF:
+		default:
+			return '\uFFFD'
+		}
+		return r
+	}, ansiEscapes.ReplaceAllString(s, ""))
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+type junitCase struct {
+	task   string
+	name   string
+	start  time.Time
+	end    time.Time
+	err    string
+	stdout strings.Builder
+	stderr strings.Builder
+}
+
+type junitSuite struct {
+	name  string
+	start time.Time
+	end   time.Time
+	cases []*junitCase
+}
+
+// JUnitReporter records every top-level task and every step run under it as test cases of a JUnit XML report,
+// from the events emitted while running them.
+// Each top-level task becomes a test suite, whose test cases are the task itself followed by its steps
+// in the order they started, including steps of the tasks run to provide inputs and steps nested in `if` and `or`.
+type JUnitReporter struct {
+	app string
+
+	mu     sync.Mutex
+	suites []*junitSuite
+	// stack holds the test cases of the tasks and steps running now, the innermost one being the last
+	stack []*junitCase
+}
+
+func NewJUnitReporter(app string) *JUnitReporter {
+	return &JUnitReporter{app: app}
+}
+
+func (r *JUnitReporter) Emit(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch e.Type {
+	case EventTaskStarted, EventStepStarted:
+		c := &junitCase{task: e.Task, name: e.Task, start: e.Time}
+		if e.Type == EventStepStarted {
+			c.name = fmt.Sprintf("step %s", e.Step)
+		} else if len(r.stack) > 0 {
+			// A task run to provide inputs isn't a test case on its own. Its steps are.
+			r.stack = append(r.stack, nil)
+			return
+		}
+		if len(r.stack) == 0 {
+			r.suites = append(r.suites, &junitSuite{name: e.Task, start: e.Time})
+		}
+		s := r.suites[len(r.suites)-1]
+		s.cases = append(s.cases, c)
+		r.stack = append(r.stack, c)
+	case EventTaskFinished, EventStepFinished:
+		if len(r.stack) == 0 {
+			return
+		}
+		c := r.stack[len(r.stack)-1]
+		r.stack = r.stack[:len(r.stack)-1]
+		if len(r.stack) == 0 {
+			r.suites[len(r.suites)-1].end = e.Time
+		}
+		if c == nil {
+			return
+		}
+		c.end = e.Time
+		c.err = e.Error
+	case EventScriptStdout, EventScriptStderr:
+		c := r.current()
+		if c == nil {
+			return
+		}
+		out := &c.stdout
+		if e.Type == EventScriptStderr {
+			out = &c.stderr
+		}
+		out.WriteString(e.Line)
+		out.WriteString("\n")
+	}
+}
+
+// merge adds the test suites recorded by other, which must have finished running them
+func (r *JUnitReporter) merge(other *JUnitReporter) {
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.suites = append(r.suites, other.suites...)
+}
+
+// current returns the test case of the innermost step running now
+func (r *JUnitReporter) current() *junitCase {
+	for i := len(r.stack) - 1; i >= 0; i-- {
+		if c := r.stack[i]; c != nil {
+			return c
+		}
+	}
+	return nil
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteReport writes the recorded test cases as a JUnit XML report
+func (r *JUnitReporter) WriteReport(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := junitTestSuites{Name: r.app}
+	var total time.Duration
+	for _, s := range r.suites {
+		suite := junitTestSuite{
+			Name:      s.name,
+			Timestamp: s.start.Format(time.RFC3339),
+			Time:      junitSeconds(s.end.Sub(s.start)),
+		}
+		if s.name == "" {
+			suite.Name = r.app
+		}
+		for _, c := range s.cases {
+			tc := junitTestCase{
+				ClassName: r.app,
+				Name:      c.name,
+				Time:      junitSeconds(c.end.Sub(c.start)),
+				SystemOut: newJUnitOutput(&c.stdout),
+				SystemErr: newJUnitOutput(&c.stderr),
+			}
+			if c.task != "" {
+				tc.ClassName = fmt.Sprintf("%s.%s", r.app, c.task)
+			}
+			if tc.Name == "" {
+				tc.Name = r.app
+			}
+			if c.err != "" {
+				tc.Failure = &junitFailure{
+					Message: c.err,
+					Type:    "error",
+					Body:    c.err,
+				}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		suite.Tests = len(suite.Cases)
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Suites = append(report.Suites, suite)
+		total += s.end.Sub(s.start)
+	}
+	report.Time = junitSeconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteReportFile writes the JUnit XML report to the file at path
+func (r *JUnitReporter) WriteReportFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create junit report")
+	}
+	defer f.Close()
+	if err := r.WriteReport(f); err != nil {
+		return errors.Wrapf(err, "failed to write junit report")
+	}
+	return nil
+}
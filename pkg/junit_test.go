@@ -0,0 +1,91 @@
+package variant
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestJUnitReporter(t *testing.T) {
+	r := NewJUnitReporter("mycmd")
+
+	at := time.Date(2019, 10, 19, 0, 0, 0, 0, time.UTC)
+	after := func(ms int) time.Time {
+		return at.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	events := EventSinks{r}
+	events.Emit(Event{Type: EventTaskStarted, Time: after(0), Task: "deploy"})
+	events.Emit(Event{Type: EventTaskStarted, Time: after(10), Task: "cluster", Caller: "deploy"})
+	events.Emit(Event{Type: EventStepStarted, Time: after(10), Task: "cluster", Step: "script"})
+	events.Emit(Event{Type: EventScriptStdout, Time: after(20), Task: "cluster", Step: "script", Line: "mycluster"})
+	events.Emit(Event{Type: EventStepFinished, Time: after(1010), Task: "cluster", Step: "script"})
+	events.Emit(Event{Type: EventTaskFinished, Time: after(1010), Task: "cluster", Caller: "deploy"})
+	events.Emit(Event{Type: EventStepStarted, Time: after(1010), Task: "deploy", Step: "step-1"})
+	events.Emit(Event{Type: EventStepStarted, Time: after(1010), Task: "deploy", Step: "or[0]"})
+	events.Emit(Event{Type: EventScriptStderr, Time: after(1020), Task: "deploy", Step: "or[0]", Line: "<denied>"})
+	events.Emit(Event{Type: EventStepFinished, Time: after(1510), Task: "deploy", Step: "or[0]", Error: "script step failed: exit status 1"})
+	events.Emit(Event{Type: EventStepFinished, Time: after(1510), Task: "deploy", Step: "step-1", Error: "script step failed: exit status 1"})
+	events.Emit(Event{Type: EventTaskFinished, Time: after(1510), Task: "deploy", Error: "script step failed: exit status 1"})
+
+	report := &bytes.Buffer{}
+	if err := r.WriteReport(report); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="mycmd" tests="4" failures="3" time="1.510">
+  <testsuite name="deploy" tests="4" failures="3" time="1.510" timestamp="2019-10-19T00:00:00Z">
+    <testcase classname="mycmd.deploy" name="deploy" time="1.510">
+      <failure message="script step failed: exit status 1" type="error">script step failed: exit status 1</failure>
+    </testcase>
+    <testcase classname="mycmd.cluster" name="step script" time="1.000">
+      <system-out><![CDATA[mycluster
+]]></system-out>
+    </testcase>
+    <testcase classname="mycmd.deploy" name="step step-1" time="0.500">
+      <failure message="script step failed: exit status 1" type="error">script step failed: exit status 1</failure>
+    </testcase>
+    <testcase classname="mycmd.deploy" name="step or[0]" time="0.500">
+      <failure message="script step failed: exit status 1" type="error">script step failed: exit status 1</failure>
+      <system-err><![CDATA[<denied>
+]]></system-err>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+	if report.String() != expected {
+		t.Errorf("unexpected report:\nexpected:\n%s\ngot:\n%s", expected, report.String())
+	}
+}
+
+func TestJUnitReporterColoredOutput(t *testing.T) {
+	r := NewJUnitReporter("mycmd")
+
+	at := time.Date(2019, 10, 19, 0, 0, 0, 0, time.UTC)
+	events := EventSinks{r}
+	events.Emit(Event{Type: EventTaskStarted, Time: at, Task: "test"})
+	events.Emit(Event{Type: EventStepStarted, Time: at, Task: "test", Step: "script"})
+	events.Emit(Event{Type: EventScriptStdout, Time: at, Task: "test", Step: "script", Line: "\x1b[31mred\x1b[0m \x1b[1;32mbold green\x1b[0m"})
+	events.Emit(Event{Type: EventScriptStderr, Time: at, Task: "test", Step: "script", Line: "bell\x07 null\x00"})
+	events.Emit(Event{Type: EventStepFinished, Time: at, Task: "test", Step: "script"})
+	events.Emit(Event{Type: EventTaskFinished, Time: at, Task: "test"})
+
+	report := &bytes.Buffer{}
+	if err := r.WriteReport(report); err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed junitTestSuites
+	if err := xml.Unmarshal(report.Bytes(), &parsed); err != nil {
+		t.Fatalf("unparseable report: %v\n%s", err, report.String())
+	}
+	c := parsed.Suites[0].Cases[1]
+	if c.SystemOut.Text != "red bold green\n" {
+		t.Errorf("unexpected stdout: %q", c.SystemOut.Text)
+	}
+	if c.SystemErr.Text != "bell\uFFFD null\uFFFD\n" {
+		t.Errorf("unexpected stderr: %q", c.SystemErr.Text)
+	}
+}
@@ -2,19 +2,13 @@ package load
 
 import (
 	"github.com/mumoshu/variant/pkg"
-	"io/ioutil"
 	"path/filepath"
 )
 
 func File(cmdPath string) (*variant.TaskDef, error) {
 	cmdName := filepath.Base(cmdPath)
 
-	yaml, err := ioutil.ReadFile(cmdPath)
-	if err != nil {
-		return nil, err
-	}
-
-	taskDef, err := YAML(string(yaml))
+	taskDef, err := variant.ReadTaskDefFromFile(cmdPath)
 	if err != nil {
 		return nil, err
 	}
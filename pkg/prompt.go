@@ -0,0 +1,144 @@
+package variant
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+	"golang.org/x/term"
+)
+
+// InputPrompter asks the user for the values of required inputs that are given via none of the value sources
+type InputPrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	// readSecret reads a line without echoing it back
+	readSecret func() (string, error)
+}
+
+func NewInputPrompter(in io.Reader, out io.Writer, readSecret func() (string, error)) *InputPrompter {
+	return &InputPrompter{
+		in:         bufio.NewReader(in),
+		out:        out,
+		readSecret: readSecret,
+	}
+}
+
+// NewTerminalInputPrompter returns a prompter reading from stdin and writing prompts to stderr, so that prompts
+// don't end up in the output of the command. It returns nil when stdin is not a terminal.
+func NewTerminalInputPrompter() *InputPrompter {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil
+	}
+	return NewInputPrompter(os.Stdin, os.Stderr, func() (string, error) {
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(b), err
+	})
+}
+
+func (p *InputPrompter) readLine() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if err != nil && !(err == io.EOF && line != "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func inputEnum(input *Input) []string {
+	enum, ok := input.Remainings["enum"].([]interface{})
+	if !ok {
+		return nil
+	}
+	choices := make([]string, len(enum))
+	for i, c := range enum {
+		choices[i] = fmt.Sprintf("%v", c)
+	}
+	return choices
+}
+
+// Confirm shows the message and returns true only when the user types exactly the expected text
+func (p *InputPrompter) Confirm(message, prompt, expected string) (bool, error) {
+	fmt.Fprintf(p.out, "%s\n%s", message, prompt)
+	line, err := p.readLine()
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(line) == expected, nil
+}
+
+func containsString(ss []string, s string) bool {
+	for _, e := range ss {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Prompt asks for the value of the input until the user enters one that is valid against the input's JSON Schema.
+// parse converts the entered string into a value of the input's type.
+func (p *InputPrompter) Prompt(input *Input, parse func(string) (interface{}, error)) (interface{}, error) {
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(input.JSONSchema()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load the json schema of input `%s`", input.Name)
+	}
+
+	if input.Description != "" {
+		fmt.Fprintf(p.out, "%s\n", input.Description)
+	}
+	choices := inputEnum(input)
+	for i, c := range choices {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, c)
+	}
+
+	for {
+		var line string
+		if input.IsSecret() {
+			fmt.Fprintf(p.out, "%s (%s, hidden): ", input.Name, input.TypeName())
+			line, err = p.readSecret()
+		} else if len(choices) > 0 {
+			fmt.Fprintf(p.out, "%s (select 1-%d): ", input.Name, len(choices))
+			line, err = p.readLine()
+		} else {
+			fmt.Fprintf(p.out, "%s (%s): ", input.Name, input.TypeName())
+			line, err = p.readLine()
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read input `%s`", input.Name)
+		}
+
+		if n, err := strconv.Atoi(line); err == nil && n >= 1 && n <= len(choices) && !containsString(choices, line) {
+			line = choices[n-1]
+		}
+
+		if input.IsSecret() {
+			secrets.Add(line)
+		}
+
+		v, err := parse(line)
+		if err != nil {
+			fmt.Fprintf(p.out, "invalid value: %v\n", err)
+			continue
+		}
+
+		result, err := schema.Validate(gojsonschema.NewGoLoader(v))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to validate input `%s`", input.Name)
+		}
+		if !result.Valid() {
+			for _, e := range result.Errors() {
+				fmt.Fprintf(p.out, "invalid value: %s\n", e.Description())
+			}
+			continue
+		}
+
+		return v, nil
+	}
+}
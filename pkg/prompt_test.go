@@ -0,0 +1,83 @@
+package variant
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestInputPrompter(t *testing.T) {
+	region := &Input{InputConfig: InputConfig{
+		Name:        "region",
+		Description: "Region to deploy to",
+		Remainings:  map[string]interface{}{"enum": []interface{}{"us-east-1", "eu-west-1"}},
+	}}
+	replicas := &Input{InputConfig: InputConfig{
+		Name:       "replicas",
+		Type:       "integer",
+		Remainings: map[string]interface{}{"minimum": 1},
+	}}
+	password := &Input{InputConfig: InputConfig{
+		Name: "password",
+		Type: "secret",
+	}}
+
+	app := &Application{Log: logrus.New()}
+	parse := func(input *Input) func(string) (interface{}, error) {
+		return func(s string) (interface{}, error) {
+			return app.parseSupportedValueFromString(s, input.TypeName())
+		}
+	}
+
+	out := &bytes.Buffer{}
+	p := NewInputPrompter(strings.NewReader("ap-northeast-1\n2\nmany\n0\n3\n"), out, func() (string, error) {
+		return "prompted-s3cr3t", nil
+	})
+
+	v, err := p.Prompt(region, parse(region))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "eu-west-1" {
+		t.Errorf("unexpected region: %v", v)
+	}
+
+	v, err = p.Prompt(replicas, parse(replicas))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != 3 {
+		t.Errorf("unexpected replicas: %v", v)
+	}
+
+	v, err = p.Prompt(password, parse(password))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "prompted-s3cr3t" {
+		t.Errorf("unexpected password: %v", v)
+	}
+	if masked := MaskSecrets("password=prompted-s3cr3t"); masked != "password=***" {
+		t.Errorf("prompted secrets must be masked: %s", masked)
+	}
+
+	prompts := out.String()
+	for _, expected := range []string{
+		"Region to deploy to\n  1) us-east-1\n  2) eu-west-1\nregion (select 1-2): invalid value: ",
+		"replicas (integer): invalid value: ",
+		"password (string, hidden): ",
+	} {
+		if !strings.Contains(prompts, expected) {
+			t.Errorf("missing %q in prompts:\n%s", expected, prompts)
+		}
+	}
+	if n := strings.Count(prompts, "invalid value: "); n != 3 {
+		t.Errorf("unexpected number of invalid values: %d\n%s", n, prompts)
+	}
+
+	if _, err := p.Prompt(replicas, parse(replicas)); err == nil {
+		t.Errorf("prompting must fail once the input is exhausted")
+	}
+}
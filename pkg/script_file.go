@@ -0,0 +1,111 @@
+package variant
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// withScriptFiles returns the YAML with the `scriptFile` of the tasks and steps read into `script`, so that the
+// scripts are included in the task definitions, and therefore in `build` outputs.
+// Relative paths are resolved against dir, the directory of the Variantfile or the imported file, and rejected when
+// dir is empty.
+func withScriptFiles(data []byte, dir string) ([]byte, error) {
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	m, ok := raw.(map[interface{}]interface{})
+	if !ok {
+		return data, nil
+	}
+	found, err := inlineScriptFilesInTask(m, dir)
+	if err != nil || !found {
+		return data, err
+	}
+	return yaml.Marshal(m)
+}
+
+func inlineScriptFilesInTask(task map[interface{}]interface{}, dir string) (bool, error) {
+	found, err := inlineScriptFile(task, dir)
+	if err != nil {
+		return false, err
+	}
+
+	var children []interface{}
+	switch tasks := task["tasks"].(type) {
+	case map[interface{}]interface{}:
+		for _, t := range tasks {
+			children = append(children, t)
+		}
+	case []interface{}:
+		children = tasks
+	}
+	for _, t := range children {
+		if t, ok := t.(map[interface{}]interface{}); ok {
+			f, err := inlineScriptFilesInTask(t, dir)
+			if err != nil {
+				return false, err
+			}
+			found = found || f
+		}
+	}
+
+	f, err := inlineScriptFilesInSteps(task["steps"], dir)
+	return found || f, err
+}
+
+// inlineScriptFilesInSteps inlines `scriptFile` of the steps, including the ones nested in `or` and `if`
+func inlineScriptFilesInSteps(steps interface{}, dir string) (bool, error) {
+	list, ok := steps.([]interface{})
+	if !ok {
+		return false, nil
+	}
+	found := false
+	for _, s := range list {
+		step, ok := s.(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		f, err := inlineScriptFile(step, dir)
+		if err != nil {
+			return false, err
+		}
+		found = found || f
+		for _, key := range []string{"or", "if", "then", "else"} {
+			f, err := inlineScriptFilesInSteps(step[key], dir)
+			if err != nil {
+				return false, err
+			}
+			found = found || f
+		}
+	}
+	return found, nil
+}
+
+// inlineScriptFile reads the `scriptFile` of the task or step into `script`, and replaces the `scriptFile` with the resolved path
+func inlineScriptFile(m map[interface{}]interface{}, dir string) (bool, error) {
+	path, ok := m["scriptFile"].(string)
+	if !ok || path == "" {
+		return false, nil
+	}
+	if m["script"] != nil {
+		return false, fmt.Errorf("both script and scriptFile %s exist", path)
+	}
+	if !filepath.IsAbs(path) {
+		if dir == "" {
+			return false, fmt.Errorf("relative scriptFile %s can't be read from the YAML embedded in the binary. Generate the Go code with `variant build` to include the script instead", path)
+		}
+		path = filepath.Join(dir, path)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to read scriptFile")
+	}
+	m["script"] = string(content)
+	m["scriptFile"] = path
+	return true, nil
+}
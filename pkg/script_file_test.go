@@ -0,0 +1,87 @@
+package variant
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestReadTaskDefWithScriptFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-scriptfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"Variantfile": `tasks:
+  deploy:
+    scriptFile: scripts/deploy.sh
+  test:
+    steps:
+    - or:
+      - scriptFile: scripts/test.sh
+        template: true
+`,
+		"scripts/deploy.sh": "echo deploy\n",
+		"scripts/test.sh":   "echo {{ .name }}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "Variantfile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = withScriptFiles(data, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var def struct {
+		Tasks map[string]struct {
+			Script     string
+			ScriptFile string `yaml:"scriptFile"`
+			Steps      []struct {
+				Or []map[string]interface{}
+			}
+		}
+	}
+	if err := yaml.Unmarshal(data, &def); err != nil {
+		t.Fatal(err)
+	}
+
+	deploy := def.Tasks["deploy"]
+	if deploy.Script != "echo deploy\n" || deploy.ScriptFile != filepath.Join(dir, "scripts/deploy.sh") {
+		t.Errorf("unexpected task: %+v", deploy)
+	}
+
+	stepDef := def.Tasks["test"].Steps[0].Or[0]
+	stepDef["name"] = "test"
+	step, err := ScriptStepLoader{}.LoadStep(NewStepDef(stepDef), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test := step.(ScriptStep)
+	if test.Code != "echo {{ .name }}\n" || test.ScriptFile != filepath.Join(dir, "scripts/test.sh") || !test.Template {
+		t.Errorf("unexpected step: %#v", test)
+	}
+
+	if _, err := withScriptFiles([]byte("script: echo\nscriptFile: scripts/deploy.sh\n"), dir); err == nil {
+		t.Error("expected an error for both script and scriptFile")
+	}
+
+	if _, err := ReadTaskDefFromString("scriptFile: scripts/deploy.sh\n"); err == nil || !strings.Contains(err.Error(), "relative scriptFile scripts/deploy.sh") {
+		t.Errorf("unexpected error for the relative scriptFile of the embedded YAML: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package variant
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const secretMask = "***"
+
+// SecretMasker remembers the values of secret inputs and replaces them with `***` wherever variant prints them.
+// The values are still passed as-is to scripts.
+type SecretMasker struct {
+	mu       sync.RWMutex
+	values   map[string]struct{}
+	replacer *strings.Replacer
+}
+
+// secrets is process-wide because secret values are printed via the standard logger and os.Stdout,
+// which are process-wide too
+var secrets = NewSecretMasker()
+
+func NewSecretMasker() *SecretMasker {
+	return &SecretMasker{values: map[string]struct{}{}}
+}
+
+// MaskSecrets replaces all the values of secret inputs found so far within s with `***`
+func MaskSecrets(s string) string {
+	return secrets.Mask(s)
+}
+
+// Add remembers all the strings within v as secrets. Non-string values like booleans are ignored,
+// as masking every `true` in the output would make it unreadable without hiding anything.
+func (m *SecretMasker) Add(v interface{}) {
+	var strs []string
+	var collect func(v interface{})
+	collect = func(v interface{}) {
+		switch t := v.(type) {
+		case string:
+			if t != "" {
+				strs = append(strs, t)
+			}
+		case []interface{}:
+			for _, e := range t {
+				collect(e)
+			}
+		case map[string]interface{}:
+			for _, e := range t {
+				collect(e)
+			}
+		}
+	}
+	collect(v)
+	if len(strs) == 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	added := false
+	for _, s := range strs {
+		if _, ok := m.values[s]; !ok {
+			m.values[s] = struct{}{}
+			added = true
+		}
+	}
+	if !added {
+		return
+	}
+	values := make([]string, 0, len(m.values))
+	for s := range m.values {
+		values = append(values, s)
+	}
+	// Mask longer secrets first so that a secret containing another one is masked as a whole
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	oldnew := make([]string, 0, len(values)*2)
+	for _, s := range values {
+		oldnew = append(oldnew, s, secretMask)
+	}
+	m.replacer = strings.NewReplacer(oldnew...)
+}
+
+func (m *SecretMasker) Mask(s string) string {
+	m.mu.RLock()
+	r := m.replacer
+	m.mu.RUnlock()
+	if r == nil {
+		return s
+	}
+	return r.Replace(s)
+}
+
+// MaskValue returns a copy of v with secrets masked. Maps and slices are masked recursively.
+// Any other value containing a secret when formatted is replaced with the masked string.
+func (m *SecretMasker) MaskValue(v interface{}) interface{} {
+	m.mu.RLock()
+	empty := m.replacer == nil
+	m.mu.RUnlock()
+	if empty {
+		return v
+	}
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return m.Mask(t)
+	case []string:
+		r := make([]string, len(t))
+		for i, e := range t {
+			r[i] = m.Mask(e)
+		}
+		return r
+	case []interface{}:
+		r := make([]interface{}, len(t))
+		for i, e := range t {
+			r[i] = m.MaskValue(e)
+		}
+		return r
+	case map[string]interface{}:
+		r := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			r[k] = m.MaskValue(e)
+		}
+		return r
+	case map[string]string:
+		r := make(map[string]string, len(t))
+		for k, e := range t {
+			r[k] = m.Mask(e)
+		}
+		return r
+	}
+	s := fmt.Sprintf("%v", v)
+	if masked := m.Mask(s); masked != s {
+		return masked
+	}
+	return v
+}
+
+// Levels and Fire make SecretMasker a logrus hook that masks secrets in every log message and field
+func (m *SecretMasker) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (m *SecretMasker) Fire(entry *logrus.Entry) error {
+	entry.Message = m.Mask(entry.Message)
+	if len(entry.Data) > 0 {
+		// Data is shared with the parent entry. Replace it instead of modifying it in place.
+		data := make(logrus.Fields, len(entry.Data))
+		for k, v := range entry.Data {
+			data[k] = m.MaskValue(v)
+		}
+		entry.Data = data
+	}
+	return nil
+}
+
+// maskSecretsInLogs installs the secret masker to the logger, unless it is already installed
+func maskSecretsInLogs(log *logrus.Logger) {
+	for _, h := range log.Hooks[logrus.InfoLevel] {
+		if h == secrets {
+			return
+		}
+	}
+	log.AddHook(secrets)
+}
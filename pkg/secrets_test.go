@@ -0,0 +1,54 @@
+package variant
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestSecretMasker(t *testing.T) {
+	m := NewSecretMasker()
+	m.Add("hunter2")
+	m.Add("hunter2pass")
+	m.Add(true)
+	m.Add(map[string]interface{}{"token": "s3cr3t", "ttl": 3600})
+
+	if got := m.Mask("user=bob password=hunter2pass old=hunter2 token=s3cr3t ok=true"); got != "user=bob password=*** old=*** token=*** ok=true" {
+		t.Errorf("unexpected masked string: %s", got)
+	}
+
+	masked := m.MaskValue(map[string]interface{}{
+		"user":     "bob",
+		"password": "hunter2pass",
+		"tokens":   []interface{}{"s3cr3t", 1},
+		"auth":     struct{ Token string }{"s3cr3t"},
+	})
+	expected := map[string]interface{}{
+		"user":     "bob",
+		"password": "***",
+		"tokens":   []interface{}{"***", 1},
+		"auth":     "{***}",
+	}
+	if !reflect.DeepEqual(masked, expected) {
+		t.Errorf("unexpected masked value: expected %v, got %v", expected, masked)
+	}
+
+	buf := &bytes.Buffer{}
+	log := logrus.New()
+	log.Out = buf
+	log.Formatter = &logrus.TextFormatter{DisableColors: true, DisableTimestamp: true}
+	log.AddHook(m)
+
+	entry := log.WithField("variables", map[string]interface{}{"password": "hunter2pass"})
+	entry.Infof("logging in with %s", "hunter2pass")
+
+	if out := buf.String(); strings.Contains(out, "hunter2") || !strings.Contains(out, "logging in with ***") || !strings.Contains(out, "variables=\"map[password:***]\"") {
+		t.Errorf("unexpected log: %s", out)
+	}
+	if v := entry.Data["variables"].(map[string]interface{})["password"]; v != "hunter2pass" {
+		t.Errorf("masking logs must not modify the fields of the entry: %v", v)
+	}
+}
@@ -1,5 +1,10 @@
 package variant
 
+import (
+	"fmt"
+	"time"
+)
+
 type Key interface {
 	ShortString() string
 	Parent() (Key, error)
@@ -22,3 +27,24 @@ type Step interface {
 type StepStringOutput struct {
 	String string
 }
+
+// runStep runs the step while emitting step events. Every step, including ones nested in `if` and `or`, is run through this
+func runStep(s Step, context ExecutionContext) (StepStringOutput, error) {
+	event := Event{App: context.app.Name, Task: context.Key().ShortString(), Step: s.GetName()}
+
+	started := time.Now()
+	event.Type = EventStepStarted
+	context.app.Events.Emit(event)
+
+	span := context.app.Tracing.start(fmt.Sprintf("step %s", s.GetName()), attrApp.String(context.app.Name), attrTask.String(event.Task), attrStep.String(s.GetName()))
+
+	output, err := s.Run(context)
+
+	span.end(err)
+
+	finished := event.withDurationSince(started).withResult(output.String, err)
+	finished.Type = EventStepFinished
+	context.app.Events.Emit(finished)
+
+	return output, err
+}
@@ -52,6 +52,11 @@ func (c ExecutionContext) Render(expr string, name string) (string, error) {
 	return c.taskTemplate.Render(expr, name)
 }
 
+// envFileVars returns the variables loaded from the `envFiles` of the app and the task
+func (c ExecutionContext) envFileVars() (envFileVars, error) {
+	return c.app.envFileVars(c.taskRunner.Task.Name)
+}
+
 func (c ExecutionContext) Autoenv() bool {
 	return c.taskRunner.Autoenv
 }
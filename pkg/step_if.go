@@ -131,7 +131,7 @@ func run(steps []Step, context ExecutionContext) (StepStringOutput, error) {
 	var lastError error
 
 	for _, s := range steps {
-		lastOutput, lastError = s.Run(context)
+		lastOutput, lastError = runStep(s, context)
 
 		if lastError != nil {
 			return StepStringOutput{String: "run error"}, errors.Wrapf(lastError, "failed running step")
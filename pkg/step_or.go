@@ -72,7 +72,7 @@ func (s OrStep) Run(context ExecutionContext) (StepStringOutput, error) {
 	for _, s := range s.Steps {
 		var output StepStringOutput
 
-		output, lastError = s.Run(context)
+		output, lastError = runStep(s, context)
 
 		if lastError == nil {
 			return output, nil
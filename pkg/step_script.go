@@ -1,10 +1,11 @@
 package variant
 
 import (
-	"bufio"
+	gocontext "context"
 	"fmt"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
 	"os"
 	"os/exec"
 	"strings"
@@ -14,6 +15,7 @@ import (
 	"compress/gzip"
 
 	"io"
+	"io/ioutil"
 	"path/filepath"
 	"runtime"
 )
@@ -97,6 +99,44 @@ func (l ScriptStepLoader) LoadStep(def StepDef, context LoadingContext) (Step, e
 				runConf.Workdir = workdir
 			}
 
+			for key, dst := range map[string]*string{
+				"runtime":  &runConf.Runtime,
+				"user":     &runConf.User,
+				"pull":     &runConf.Pull,
+				"platform": &runConf.Platform,
+				"cpus":     &runConf.CPUs,
+				"memory":   &runConf.Memory,
+			} {
+				if v, ok := runner[key]; ok && v != nil {
+					// Allows numbers like `cpus: 0.5` and `user: 1000`
+					*dst = fmt.Sprintf("%v", v)
+				}
+			}
+
+			for key, dst := range map[string]*bool{
+				"mountCwd":     &runConf.MountCwd,
+				"mountWorkdir": &runConf.MountWorkdir,
+				"mapUser":      &runConf.MapUser,
+			} {
+				if v, ok := runner[key].(bool); ok {
+					*dst = v
+				}
+			}
+
+			if passEnv, ok := runner["passEnv"].([]interface{}); ok {
+				for _, name := range passEnv {
+					runConf.PassEnv = append(runConf.PassEnv, fmt.Sprintf("%v", name))
+				}
+			}
+
+			if ssh, ok := runner["ssh"].(map[interface{}]interface{}); ok {
+				runConf.SSH = loadSSHConfig(ssh)
+			}
+
+			if kubernetes, ok := runner["kubernetes"].(map[interface{}]interface{}); ok {
+				runConf.Kubernetes = loadKubernetesConfig(kubernetes)
+			}
+
 		} else {
 			log.Debugf("runner wasn't expected type of map: %+v", runner)
 		}
@@ -111,6 +151,36 @@ func (l ScriptStepLoader) LoadStep(def StepDef, context LoadingContext) (Step, e
 			Code:   script,
 			Silent: def.Silent(),
 		}
+		if env, ok := def.Get("env").(map[interface{}]interface{}); ok {
+			step.Env = make(map[string]string, len(env))
+			for k, v := range env {
+				step.Env[fmt.Sprintf("%v", k)] = fmt.Sprintf("%v", v)
+			}
+		}
+		if workdir, ok := def.Get("workdir").(string); ok {
+			step.Workdir = workdir
+		}
+		if shell, ok := def.Get("shell").(string); ok {
+			step.Shell = shell
+		}
+		for key, dst := range map[string]*[]string{"produces": &step.Produces, "consumes": &step.Consumes} {
+			if globs, ok := def.Get(key).([]interface{}); ok {
+				for _, g := range globs {
+					*dst = append(*dst, fmt.Sprintf("%v", g))
+				}
+			}
+		}
+		if scriptFile, ok := def.Get("scriptFile").(string); ok {
+			step.ScriptFile = scriptFile
+			step.Template, _ = def.Get("template").(bool)
+		}
+		if output, ok := def.Get("output").(string); ok {
+			if output != rawOutput {
+				return nil, fmt.Errorf("unsupported output %q. One of: %s", output, rawOutput)
+			}
+			step.Output = output
+			step.OutputFile, _ = def.Get("outputFile").(string)
+		}
 		if runConf != nil {
 			step.RunnerConfig = *runConf
 		}
@@ -125,10 +195,25 @@ func NewScriptStepLoader() ScriptStepLoader {
 }
 
 type ScriptStep struct {
-	Name         string
-	Code         string
-	Silent       bool
+	Name   string
+	Code   string
+	Silent bool
+	// Env, Workdir and Shell override the ones of the task
+	Env     map[string]string
+	Workdir string
+	Shell   string
+	// ScriptFile is the path to the file the Code was read from. The code is rendered as a template only when Template is set
+	ScriptFile string
+	Template   bool
+	// Produces and Consumes are globs of the files to pass to later steps via the workspace
+	Produces []string
+	Consumes []string
+	// Output is `raw` to write the stdout as-is to OutputFile, or the stdout when it's empty, without capturing it
+	Output       string
+	OutputFile   string
 	RunnerConfig RunnerConfig
+
+	rawOutput io.Writer
 }
 
 type Artifact struct {
@@ -148,35 +233,73 @@ type RunnerConfig struct {
 	Volumes    []string
 	Net        string
 	Workdir    string
+	// Runtime is the container runtime to run the image with. One of: docker|podman|nerdctl
+	Runtime  string
+	User     string
+	Pull     string
+	Platform string
+	CPUs     string
+	Memory   string
+	// MountCwd mounts the current directory at the same path in the container, and makes it the workdir unless Workdir is set
+	MountCwd bool
+	// MountWorkdir is like MountCwd but mounts the directory of the Variantfile
+	MountWorkdir bool
+	// MapUser runs the container as the host user, so that files created in mounted directories are owned by the user
+	MapUser bool
+	// PassEnv are the names of the variables to pass through to the container, without showing the values in the command
+	PassEnv []string
+	// SSH runs the script on the remote host instead of locally
+	SSH *SSHConfig
+	// Kubernetes runs the script in a pod instead of locally
+	Kubernetes *KubernetesConfig
+
+	runtime containerRuntime
+	// kubeClient is the client to create the pod with, instead of the one for the kubeconfig
+	kubeClient kubernetes.Interface
+	// envNames are the names of the variables of `env` set to the runtime process to pass through to the container
+	envNames []string
+	// interpreter is the command and args to run scriptFile with, instead of passing the script as an arg
+	interpreter []string
+	scriptFile  string
+	// artifactTarballs are the downloaded tarballs of the artifacts to be extracted within the container
+	artifactTarballs []string
+	// consumed are the files in the workspace to be mounted into the container
+	consumed []string
 }
 
-func (c RunnerConfig) commandNameAndArgsToRunScript(script string, context ExecutionContext) (string, []string) {
-	var cmd string
-	if c.Command != "" {
-		cmd = c.Command
-	} else if c.Image == "" {
-		cmd = "bash"
-	}
-
-	for _, a := range c.Artifacts {
-		s3Prefix, err := context.Render(a.Via, "runner.via")
-		if err != nil {
-			panic(err)
-		}
-		name := a.Name
-		setup := fmt.Sprintf(`echo downloading artifacts from %s/%s.tgz 1>&2
-aws s3 cp %s/%s.tgz %s.tgz 1>&2
-tar zxvf %s.tgz 1>&2
-`, s3Prefix, name, s3Prefix, name, name, name)
-		script = setup + script
+// scriptWithArtifactExtraction prepends the commands to extract the artifacts mounted into the container to the script
+func (c RunnerConfig) scriptWithArtifactExtraction(script string) string {
+	var setup string
+	for _, t := range c.artifactTarballs {
+		setup += fmt.Sprintf("tar zxvf %s 1>&2\n", t)
 	}
+	return setup + script
+}
 
+func (c RunnerConfig) commandNameAndArgsToRunScript(script string, context ExecutionContext) (string, []string) {
+	var cmd string
 	var cmdArgs []string
-	if c.Args != nil {
-		cmdArgs = append([]string{}, c.Args...)
-		cmdArgs = append(cmdArgs, script)
+	if len(c.interpreter) > 0 {
+		cmd = c.interpreter[0]
+		cmdArgs = append(append([]string{}, c.interpreter[1:]...), c.scriptFile)
+	} else if c.interpreter != nil {
+		// The entrypoint of the image runs the file
+		cmd = c.scriptFile
 	} else {
-		cmdArgs = []string{"-c", script}
+		if c.Command != "" {
+			cmd = c.Command
+		} else if c.Image == "" {
+			cmd = "bash"
+		}
+
+		script = c.scriptWithArtifactExtraction(script)
+
+		if c.Args != nil {
+			cmdArgs = append([]string{}, c.Args...)
+			cmdArgs = append(cmdArgs, script)
+		} else {
+			cmdArgs = []string{"-c", script}
+		}
 	}
 
 	if c.Image != "" {
@@ -193,37 +316,34 @@ tar zxvf %s.tgz 1>&2
 			}
 		}
 
-		dockerArgs := []string{}
-		for _, v := range c.Volumes {
-			dockerArgs = append(dockerArgs, "-v", os.ExpandEnv(v))
-		}
-		for k, v := range c.Env {
-			dockerArgs = append(dockerArgs, "-e", fmt.Sprintf("%s=%s", k, os.ExpandEnv(v)))
+		runtime := c.runtime
+		if runtime == nil {
+			runtime = containerRuntimes[defaultContainerRuntime]
 		}
-		if c.Envfile != "" {
-			dockerArgs = append(dockerArgs, "--env-file", os.ExpandEnv(c.Envfile))
-		}
-		if c.Entrypoint != nil {
-			dockerArgs = append(dockerArgs, "--entrypoint", *c.Entrypoint)
-		}
-		if c.Net != "" {
-			dockerArgs = append(dockerArgs, "--net", c.Net)
-		}
-		if c.Workdir != "" {
-			dockerArgs = append(dockerArgs, "--workdir", c.Workdir)
-		}
-		var args []string
-		args = append(args, dockerArgs...)
-		args = append(args, c.Image)
-		args = append(args, cmd)
-		args = append(args, cmdArgs...)
-
-		return "docker", append([]string{"run", "--rm", "-i"}, args...)
+		return runtime.runCommand(c.containerRun(append([]string{cmd}, cmdArgs...), context))
 	} else {
 		return cmd, cmdArgs
 	}
 }
 
+// killOnCancel kills the process group of the started command once ctx is done, until the returned func is called
+func killOnCancel(ctx gocontext.Context, cmd *exec.Cmd) func() {
+	if ctx == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := killProcessGroup(cmd); err != nil {
+				log.Errorf("failed to kill %s: %v", cmd.Path, err)
+			}
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
 func (s ScriptStep) Silenced() bool {
 	return s.Silent
 }
@@ -235,44 +355,176 @@ func (s ScriptStep) GetName() string {
 func (s ScriptStep) Run(context ExecutionContext) (StepStringOutput, error) {
 	depended := len(context.Caller()) > 0
 
-	script, err := context.Render(s.Code, s.GetName())
-	if err != nil {
-		log.WithFields(log.Fields{"source": s.Code, "vars": context.Vars}).Errorf("script step failed templating")
-		return StepStringOutput{String: "scripterror"}, errors.Wrapf(err, "script step failed templating")
+	var consumed []string
+	if len(s.Produces) > 0 || len(s.Consumes) > 0 {
+		dir, err := context.app.workspace.path()
+		if err != nil {
+			return StepStringOutput{}, err
+		}
+		consumed, err = context.app.workspace.consume(s.Consumes)
+		if err != nil {
+			return StepStringOutput{}, err
+		}
+		if _, ok := context.Values()["workspace"]; !ok {
+			context = context.WithAdditionalValues(map[string]interface{}{
+				"workspace": map[string]interface{}{"dir": dir, "consumed": consumed},
+			})
+		}
 	}
 
-	output, err := s.runScriptWithArtifacts(script, depended, context)
+	script := s.Code
+	if s.ScriptFile == "" || s.Template {
+		var err error
+		script, err = context.Render(s.Code, s.GetName())
+		if err != nil {
+			log.WithFields(log.Fields{"source": s.Code, "vars": context.Vars}).Errorf("script step failed templating")
+			return StepStringOutput{String: "scripterror"}, errors.Wrapf(err, "script step failed templating")
+		}
+	}
+
+	if s.Output == rawOutput {
+		w, closeOutput, err := s.openRawOutput(context)
+		if err != nil {
+			return StepStringOutput{}, err
+		}
+		s.rawOutput = w
+		output, err := s.runScriptWithArtifacts(script, consumed, depended, context)
+		if closeErr := closeOutput(); err == nil && closeErr != nil {
+			err = errors.Wrapf(closeErr, "failed to write outputFile")
+		}
+		return StepStringOutput{String: output}, err
+	}
+
+	output, err := s.runScriptWithArtifacts(script, consumed, depended, context)
 
 	return StepStringOutput{String: output}, err
 }
 
-func (t ScriptStep) runScriptWithArtifacts(script string, depended bool, context ExecutionContext) (string, error) {
-	for _, a := range t.RunnerConfig.Artifacts {
-		err := createTarFromGlob(fmt.Sprintf("%s.tgz", a.Name), a.Path)
+// runScriptWithArtifacts runs the script after staging the artifacts, and copies the files to produce into the workspace.
+// consumed are the files in the workspace to be mounted into the container.
+func (t ScriptStep) runScriptWithArtifacts(script string, consumed []string, depended bool, context ExecutionContext) (string, error) {
+	env, err := t.execEnv(context)
+	if err != nil {
+		return "", err
+	}
+
+	workdir, err := t.execWorkdir(context)
+	if err != nil {
+		return "", err
+	}
+
+	runner := t.RunnerConfig
+
+	if runner.SSH != nil {
+		if runner.Image != "" {
+			return "", fmt.Errorf("runner.ssh and runner.image are mutually exclusive")
+		}
+		if len(t.Produces) > 0 || len(t.Consumes) > 0 {
+			return "", fmt.Errorf("produces and consumes are not supported with runner.ssh")
+		}
+		return t.runScriptOverSSH(script, env, workdir, context)
+	}
+
+	if runner.Kubernetes != nil {
+		if runner.Image != "" {
+			return "", fmt.Errorf("runner.kubernetes and runner.image are mutually exclusive. Set the image with runner.kubernetes.image")
+		}
+		if len(runner.Artifacts) > 0 || len(t.Produces) > 0 || len(t.Consumes) > 0 {
+			return "", fmt.Errorf("artifacts, produces and consumes are not supported with runner.kubernetes")
+		}
+		return t.runScriptInKubernetes(script, env, workdir, context)
+	}
+
+	var dir string
+	if runner.Image != "" {
+		if err := runner.validateContainerOptions(); err != nil {
+			return "", err
+		}
+		runner.runtime, err = containerRuntimeFor(runner.Runtime, context.app.ContainerRuntime)
+		if err != nil {
+			return "", err
+		}
+		runner.envNames = sortedKeys(env)
+		runner.consumed = consumed
+		if runner.Workdir == "" && workdir != "" {
+			// The same path as on the host, as the container's workdir needs to be absolute
+			runner.Workdir, err = filepath.Abs(workdir)
+			if err != nil {
+				return "", err
+			}
+		}
+	} else if workdir != "" {
+		dir, err = hostWorkdir(workdir)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		dir = context.autodir()
+	}
+
+	if len(runner.Artifacts) > 0 {
+		staging, err := ioutil.TempDir("", "variant-artifacts")
 		if err != nil {
 			return "", err
 		}
-		via, err := context.Render(a.Via, "runner.via")
+		defer os.RemoveAll(staging)
+		tarballs, err := runner.transferArtifacts(staging, context)
 		if err != nil {
 			return "", err
 		}
-		setup := fmt.Sprintf(`aws s3 cp %s.tgz %s/%s.tgz 1>&2`, a.Name, via, a.Name)
-		name, args := RunnerConfig{}.commandNameAndArgsToRunScript(setup, context)
-		out, err := t.runCommand(name, args, depended, context)
+		if runner.Image != "" {
+			runner.artifactTarballs = tarballs
+		} else {
+			for _, tarball := range tarballs {
+				if err := extractTar(tarball, dir); err != nil {
+					return "", errors.Wrapf(err, "failed to extract %s", tarball)
+				}
+			}
+		}
+	}
+
+	interpreter, ext, err := t.interpreter(script, context)
+	if err != nil {
+		return "", err
+	}
+	if interpreter != nil {
+		file, err := writeScriptFile(runner.scriptWithArtifactExtraction(script), ext, runner.Image != "")
 		if err != nil {
-			return out, err
+			return "", err
 		}
+		defer os.Remove(file)
+		runner.interpreter = interpreter
+		runner.scriptFile = file
 	}
 
-	name, args := t.RunnerConfig.commandNameAndArgsToRunScript(script, context)
-	output, err := t.runCommand(name, args, depended, context)
+	name, args := runner.commandNameAndArgsToRunScript(script, context)
+	output, err := t.runCommand(name, args, dir, env, depended, context)
 	if err != nil {
 		return output, err
 	}
+
+	if len(t.Produces) > 0 {
+		producesDir := dir
+		if runner.Image != "" {
+			// Files created in the container are on the host only when they're in a mounted directory
+			if runner.MountWorkdir {
+				producesDir, err = context.app.variantfileDir()
+			} else if workdir != "" {
+				producesDir, err = filepath.Abs(workdir)
+			}
+			if err != nil {
+				return output, err
+			}
+		}
+		if err := context.app.workspace.produce(t.Produces, producesDir); err != nil {
+			return output, err
+		}
+	}
 	return output, nil
 }
 
-func (t ScriptStep) runCommand(name string, args []string, depended bool, context ExecutionContext) (string, error) {
+// runCommand runs the command in dir with env added to the environment. The autodir is used when dir is empty.
+func (t ScriptStep) runCommand(name string, args []string, dir string, env map[string]string, depended bool, context ExecutionContext) (string, error) {
 	applog := log.StandardLogger().WithField("app", context.app.Name)
 	taskKey := context.Key().ShortString()
 	tasklog := applog.WithField("task", taskKey)
@@ -281,6 +533,30 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 	tasklog.Debugf("starting command %s %s", name, strings.TrimSuffix(strings.Join(args, " "), "\n"))
 
 	cmd := exec.Command(name, args...)
+	if context.app.ctx != nil {
+		// Scripts of runs in the background are killed along with the processes they started when the run is cancelled
+		setProcessGroup(cmd)
+	}
+
+	span := context.app.Tracing.start(fmt.Sprintf("exec %s", name), attrApp.String(context.app.Name), attrTask.String(taskKey), attrStep.String(t.GetName()), attrCommand.String(name))
+
+	envFiles, err := context.envFileVars()
+	if err != nil {
+		span.end(err)
+		return "", err
+	}
+	if len(envFiles) > 0 || len(env) > 0 {
+		// The env of the task and the step overrides the environment, while env files don't
+		cmd.Env = append(append(os.Environ(), envFiles.environ()...), environ(env)...)
+	}
+
+	// Let tools run by the script join the trace
+	if traceparent := context.app.Tracing.Traceparent(); traceparent != "" {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", TraceparentEnv, traceparent))
+	}
 
 	mergedEnv := map[string]string{}
 
@@ -290,25 +566,18 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 		mergedEnv[key] = value
 	}
 
-	if context.Autodir() {
-		parentKey, err := context.Key().Parent()
-		if parentKey != nil {
-			shortKey := parentKey.ShortString()
-			path := strings.Replace(shortKey, ".", "/", -1)
-			if err != nil {
-				log.Debugf("%s does not have parent", context.Key().ShortString())
-			} else {
-				if _, err := os.Stat(path); err == nil {
-					cmd.Dir = path
-				}
-			}
-		}
+	if dir != "" {
+		cmd.Dir = dir
+	} else {
+		cmd.Dir = context.autodir()
 	}
 
 	errOut := ""
 	resOut := ""
+	var streamErr error
 
 	var done chan struct{}
+	stopKilling := func() {}
 
 	if context.Interactive() {
 		cmd.Stdin = os.Stdin
@@ -317,9 +586,15 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 
 		// Start the command
 		if err := cmd.Start(); err != nil {
+			// Runs in the background fail without exiting the process running them, like `runs serve`
+			if context.app.ctx != nil {
+				span.end(err)
+				return "", errors.Wrapf(err, "failed to start %s", name)
+			}
 			fmt.Fprintln(os.Stderr, "Error starting Cmd", err)
 			os.Exit(1)
 		}
+		stopKilling = killOnCancel(context.app.ctx, cmd)
 	} else {
 		done = make(chan struct{})
 		defer func() {
@@ -339,108 +614,24 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 
 		// Start the command
 		if err := cmd.Start(); err != nil {
+			// Runs in the background fail without exiting the process running them, like `runs serve`
+			if context.app.ctx != nil {
+				span.end(err)
+				return "", errors.Wrapf(err, "failed to start %s", name)
+			}
 			fmt.Fprintln(os.Stderr, "Error starting Cmd", err)
 			os.Exit(1)
 		}
+		stopKilling = killOnCancel(context.app.ctx, cmd)
 
-		// Receive stdout and stderr
-
-		channels := struct {
-			Stdout chan string
-			Stderr chan string
-		}{
-			Stdout: make(chan string),
-			Stderr: make(chan string),
-		}
-
-		scanner := bufio.NewScanner(cmdReader)
-		go func() {
-			defer func() {
-				close(channels.Stdout)
-			}()
-			for scanner.Scan() {
-				text := scanner.Text()
-				errOutPrefix := "variant.stderr: "
-				if strings.HasPrefix(text, errOutPrefix) {
-					channels.Stderr <- strings.SplitN(text, errOutPrefix, 2)[1]
-				} else {
-					channels.Stdout <- text
-				}
-			}
-		}()
-
-		errScanner := bufio.NewScanner(errReader)
-		go func() {
-			defer func() {
-				close(channels.Stderr)
-			}()
-			for errScanner.Scan() {
-				text := errScanner.Text()
-				channels.Stderr <- text
-			}
-		}()
-
-		stdoutEnds := false
-		stderrEnds := false
-
-		var writeToOut func(str string)
-		var writeToErr func(str string)
-
-		// Print logs to stdout and stderr only when this is the command called by the user, directly or indirectly, as a task script. not as an input
-		if !context.asInput {
-			writeToOut = func(str string) {
-				fmt.Fprint(os.Stdout, str, "\n")
-			}
-			writeToErr = func(str string) {
-				tasklog.Warn(str)
-			}
-		} else {
-			writeToOut = func(str string) {
-				tasklog.Info(str)
-			}
-			writeToErr = func(str string) {
-				tasklog.Warn(str)
-			}
-		}
-
-		// Coordinating stdout/stderr in this single place to not screw up message ordering
-		for {
-			select {
-			case text, ok := <-channels.Stdout:
-				if ok {
-					//if depended {
-					//	stdoutlog.Debug(text)
-					//} else {
-					writeToOut(text)
-					//}
-					if resOut != "" {
-						resOut += "\n"
-					}
-					resOut += text
-				} else {
-					stdoutEnds = true
-				}
-			case text, ok := <-channels.Stderr:
-				if ok {
-					writeToErr(text)
-					if errOut != "" {
-						errOut += "\n"
-					}
-					errOut += text
-				} else {
-					stderrEnds = true
-				}
-			}
-			if stdoutEnds && stderrEnds {
-				break
-			}
-		}
+		resOut, errOut, streamErr = t.streamOutput(cmdReader, errReader, context)
 		log.Debugf("closing...")
 		close(done)
 	}
 
 	var waitStatus syscall.WaitStatus
-	err := cmd.Wait()
+	err = cmd.Wait()
+	stopKilling()
 
 	if done != nil {
 		log.Debugf("waiting for all the stdout/stderr contents to be consumed...in case this hangs, file a bug report.")
@@ -450,6 +641,10 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 		log.Debugf("done consuming stdout and stderr")
 	}
 
+	if err == nil && streamErr != nil {
+		err = streamErr
+	}
+
 	if err != nil {
 		tasklog.Errorf("script step failed: %v", err)
 		// Did the command fail because of an unsuccessful exit code
@@ -457,14 +652,33 @@ func (t ScriptStep) runCommand(name string, args []string, depended bool, contex
 			waitStatus = exitError.Sys().(syscall.WaitStatus)
 			log.Errorf("exit status was %d", waitStatus.ExitStatus())
 		}
+		span.end(err, attrExitStatus.Int(waitStatus.ExitStatus()))
 		return strings.Trim(errOut, "\n "), errors.Wrap(err, "script step failed")
 	} else {
 		// Command was successful
 		waitStatus = cmd.ProcessState.Sys().(syscall.WaitStatus)
 		log.Debugf("script step finished command with status: %d", waitStatus.ExitStatus())
+		span.end(nil, attrExitStatus.Int(waitStatus.ExitStatus()))
 	}
 
-	return strings.Trim(resOut, "\n "), nil
+	return trimOutput(resOut), nil
+}
+
+// autodir returns the directory for the task when `autodir` is enabled and the directory exists, or an empty string
+func (c ExecutionContext) autodir() string {
+	if !c.Autodir() {
+		return ""
+	}
+	parentKey, err := c.Key().Parent()
+	if err != nil || parentKey == nil {
+		log.Debugf("%s does not have parent", c.Key().ShortString())
+		return ""
+	}
+	path := strings.Replace(parentKey.ShortString(), ".", "/", -1)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
 }
 
 func createTarFromGlob(filename string, pattern string) error {
@@ -528,6 +742,44 @@ func writeFileToTar(writer *tar.Writer, filename string) error {
 	return err
 }
 
+// extractTar extracts the gzipped tarball into dir, or the current directory when dir is empty
+func extractTar(tarball, dir string) error {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, sanitizedName(header.Name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode).Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(file, reader); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+}
+
 func sanitizedName(filename string) string {
 	if len(filename) > 1 && filename[1] == ':' &&
 		runtime.GOOS == "windows" {
@@ -0,0 +1,92 @@
+package variant
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// taskAndAncestors returns the task and its ancestors, from the top-level task down to the task
+func (c ExecutionContext) taskAndAncestors() []*Task {
+	var tasks []*Task
+	name := c.taskRunner.Task.Name
+	for k := range name.Components {
+		if t := c.app.TaskRegistry.FindTask(TaskName{Components: name.Components[:k+1]}); t != nil {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// execEnv returns the `env` of the task and its ancestors overridden by the step's, with the values rendered
+func (s ScriptStep) execEnv(context ExecutionContext) (map[string]string, error) {
+	templates := map[string]string{}
+	for _, t := range context.taskAndAncestors() {
+		for k, v := range t.Env {
+			templates[k] = v
+		}
+	}
+	for k, v := range s.Env {
+		templates[k] = v
+	}
+
+	env := make(map[string]string, len(templates))
+	for k, v := range templates {
+		r, err := context.Render(v, fmt.Sprintf("env.%s", k))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to render env %s", k)
+		}
+		env[k] = r
+	}
+	return env, nil
+}
+
+// execWorkdir returns the rendered `workdir` of the step, or the nearest one of the task and its ancestors.
+// It returns an empty string when none of them has `workdir`.
+func (s ScriptStep) execWorkdir(context ExecutionContext) (string, error) {
+	workdir := s.Workdir
+	if workdir == "" {
+		tasks := context.taskAndAncestors()
+		for i := len(tasks) - 1; i >= 0 && workdir == ""; i-- {
+			workdir = tasks[i].Workdir
+		}
+	}
+	if workdir == "" {
+		return "", nil
+	}
+	return context.Render(workdir, "workdir")
+}
+
+// hostWorkdir returns the absolute path of the workdir to run the command on the host in, after checking that it exists
+func hostWorkdir(workdir string) (string, error) {
+	abs, err := filepath.Abs(workdir)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(abs); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("workdir %s does not exist", abs)
+	}
+	return abs, nil
+}
+
+// environ returns the env in the form of `KEY=VALUE` sorted by the keys
+func environ(env map[string]string) []string {
+	names := sortedKeys(env)
+	vars := make([]string, len(names))
+	for i, k := range names {
+		vars[i] = fmt.Sprintf("%s=%s", k, env[k])
+	}
+	return vars
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,66 @@
+package variant
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScriptStepEnvAndWorkdir(t *testing.T) {
+	deploy := &Task{
+		TaskDef: TaskDef{
+			Env:     map[string]string{"REGION": "{{ .region }}", "STAGE": "deploy"},
+			Workdir: "deploy",
+		},
+		Name:        TaskName{Components: []string{"mycmd", "deploy"}},
+		ProjectName: "mycmd",
+	}
+	app := &Task{
+		TaskDef: TaskDef{
+			Env: map[string]string{"STAGE": "app", "TEAM": "infra"},
+		},
+		Name:        TaskName{Components: []string{"mycmd", "deploy", "app"}},
+		ProjectName: "mycmd",
+	}
+	root := &Task{
+		TaskDef: TaskDef{
+			Env: map[string]string{"TEAM": "root", "APP": "mycmd"},
+		},
+		Name:        TaskName{Components: []string{"mycmd"}},
+		ProjectName: "mycmd",
+	}
+	registry := NewTaskRegistry()
+	for _, task := range []*Task{root, deploy, app} {
+		registry.put(task.Name, task)
+	}
+
+	tmpl := NewTaskTemplate(app, map[string]interface{}{"region": "eu-west-1", "name": "web"})
+	context := NewStepExecutionContext(Application{TaskRegistry: registry}, TaskRunner{Task: app, Template: tmpl}, tmpl, false, nil)
+
+	step := ScriptStep{Env: map[string]string{"TEAM": "{{ .name }}"}}
+
+	env, err := step.execEnv(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"APP": "mycmd", "REGION": "eu-west-1", "STAGE": "app", "TEAM": "web"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("unexpected env: expected %v, got %v", expected, env)
+	}
+
+	workdir, err := step.execWorkdir(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workdir != "deploy" {
+		t.Errorf("unexpected workdir inherited from the parent task: %q", workdir)
+	}
+
+	step.Workdir = "apps/{{ .name }}"
+	workdir, err = step.execWorkdir(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workdir != "apps/web" {
+		t.Errorf("unexpected workdir of the step: %q", workdir)
+	}
+}
@@ -0,0 +1,108 @@
+package variant
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// shellInterpreter is the command to run a script file with for a `shell`, and the extension of the file
+type shellInterpreter struct {
+	Command []string
+	Ext     string
+}
+
+// shells are the supported values of `shell`. Shells run scripts with the options to exit on errors and undefined variables.
+var shells = map[string]shellInterpreter{
+	"bash":    {Command: []string{"bash", "-euo", "pipefail"}, Ext: ".sh"},
+	"sh":      {Command: []string{"sh", "-eu"}, Ext: ".sh"},
+	"python3": {Command: []string{"python3"}, Ext: ".py"},
+	"node":    {Command: []string{"node"}, Ext: ".js"},
+	"pwsh":    {Command: []string{"pwsh", "-NoProfile", "-NonInteractive", "-File"}, Ext: ".ps1"},
+}
+
+// execShell returns the `shell` of the step, or the nearest one of the task and its ancestors
+func (s ScriptStep) execShell(context ExecutionContext) string {
+	if s.Shell != "" {
+		return s.Shell
+	}
+	tasks := context.taskAndAncestors()
+	for i := len(tasks) - 1; i >= 0; i-- {
+		if tasks[i].Shell != "" {
+			return tasks[i].Shell
+		}
+	}
+	return ""
+}
+
+// interpreter returns the command and args to run the script written to a file, followed by the extension of the file.
+// A leading `#!` line of the script takes precedence over `shell`. Images are run with `sh` by default, as not all
+// images have `bash`, or with their `runner.entrypoint` given the file. It returns nil when the script should be
+// run the legacy way, that is when `runner.command` or `runner.args` is set.
+func (s ScriptStep) interpreter(script string, context ExecutionContext) ([]string, string, error) {
+	runner := s.RunnerConfig
+	if runner.Command != "" || len(runner.Args) > 0 {
+		return nil, "", nil
+	}
+
+	if command := shebang(script); command != nil {
+		name := filepath.Base(command[0])
+		if name == "env" && len(command) > 1 {
+			name = command[1]
+		}
+		return command, shells[name].Ext, nil
+	}
+
+	shell := s.execShell(context)
+	if shell == "" {
+		if runner.Image != "" {
+			if runner.Entrypoint != nil && *runner.Entrypoint != "" {
+				return []string{}, "", nil
+			}
+			return []string{"sh"}, ".sh", nil
+		}
+		// No strict options by default, so that existing scripts keep working
+		return []string{"bash"}, ".sh", nil
+	}
+	interp, ok := shells[shell]
+	if !ok {
+		return nil, "", fmt.Errorf("unsupported shell %q. One of: bash|sh|python3|node|pwsh", shell)
+	}
+	return append([]string{}, interp.Command...), interp.Ext, nil
+}
+
+// shebang returns the interpreter and its args in the leading `#!` line of the script, or nil if there is none
+func shebang(script string) []string {
+	if !strings.HasPrefix(script, "#!") {
+		return nil
+	}
+	line := strings.SplitN(script[2:], "\n", 2)[0]
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields
+}
+
+// writeScriptFile writes the script to a temporary file with the extension and returns its path.
+// The file is made readable by others when it's going to be mounted into a container, whose user may differ.
+func writeScriptFile(script, ext string, container bool) (string, error) {
+	f, err := ioutil.TempFile("", "variant-script-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if _, err := f.WriteString(script); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	if container {
+		if err := f.Chmod(0644); err != nil {
+			os.Remove(f.Name())
+			return "", err
+		}
+	}
+	return f.Name(), nil
+}
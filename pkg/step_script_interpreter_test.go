@@ -0,0 +1,71 @@
+package variant
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScriptStepInterpreter(t *testing.T) {
+	root := &Task{
+		TaskDef:     TaskDef{Shell: "sh"},
+		Name:        TaskName{Components: []string{"mycmd"}},
+		ProjectName: "mycmd",
+	}
+	task := &Task{
+		Name:        TaskName{Components: []string{"mycmd", "build"}},
+		ProjectName: "mycmd",
+	}
+	registry := NewTaskRegistry()
+	registry.put(root.Name, root)
+	registry.put(task.Name, task)
+
+	tmpl := NewTaskTemplate(task, map[string]interface{}{})
+	context := NewStepExecutionContext(Application{TaskRegistry: registry}, TaskRunner{Task: task, Template: tmpl}, tmpl, false, nil)
+
+	testcases := []struct {
+		step   ScriptStep
+		script string
+		cmd    []string
+		ext    string
+	}{
+		{step: ScriptStep{}, script: "echo", cmd: []string{"sh", "-eu"}, ext: ".sh"},
+		{step: ScriptStep{Shell: "python3"}, script: "print(1)", cmd: []string{"python3"}, ext: ".py"},
+		{step: ScriptStep{Shell: "bash"}, script: "#!/usr/bin/env node\nconsole.log(1)", cmd: []string{"/usr/bin/env", "node"}, ext: ".js"},
+		{step: ScriptStep{Shell: "bash"}, script: "#!/bin/bash -ex\necho", cmd: []string{"/bin/bash", "-ex"}, ext: ".sh"},
+		{step: ScriptStep{RunnerConfig: RunnerConfig{Command: "ruby"}}, script: "puts 1", cmd: nil, ext: ""},
+	}
+	for i, tc := range testcases {
+		cmd, ext, err := tc.step.interpreter(tc.script, context)
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(cmd, tc.cmd) || ext != tc.ext {
+			t.Errorf("case %d: expected %v %q, got %v %q", i, tc.cmd, tc.ext, cmd, ext)
+		}
+	}
+
+	root.Shell = ""
+	cmd, _, err := ScriptStep{RunnerConfig: RunnerConfig{Image: "alpine"}}.interpreter("echo", context)
+	if err != nil || !reflect.DeepEqual(cmd, []string{"sh"}) {
+		t.Errorf("expected sh in the image by default, got %v, %v", cmd, err)
+	}
+	entrypoint := "/docker-entrypoint.sh"
+	runner := RunnerConfig{Image: "nginx", Entrypoint: &entrypoint}
+	cmd, _, err = ScriptStep{RunnerConfig: runner}.interpreter("echo", context)
+	if err != nil || cmd == nil || len(cmd) != 0 {
+		t.Errorf("expected the entrypoint of the image to run the script file, got %v, %v", cmd, err)
+	}
+	runner.interpreter, runner.scriptFile, runner.runtime = cmd, "/tmp/variant-script-1", containerRuntimes["docker"]
+	if name, args := runner.commandNameAndArgsToRunScript("echo", context); name != "docker" || args[len(args)-1] != "/tmp/variant-script-1" {
+		t.Errorf("expected the script file to be passed to the entrypoint, got %s %v", name, args)
+	}
+	cmd, _, err = ScriptStep{}.interpreter("echo", context)
+	if err != nil || !reflect.DeepEqual(cmd, []string{"bash"}) {
+		t.Errorf("expected bash without options by default, got %v, %v", cmd, err)
+	}
+
+	_, _, err = ScriptStep{Shell: "ruby"}.interpreter("puts 1", context)
+	if err == nil || err.Error() != `unsupported shell "ruby". One of: bash|sh|python3|node|pwsh` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,419 @@
+package variant
+
+import (
+	"bytes"
+	gocontext "context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// KubernetesConfig is the pod to run the script in, via `runner.kubernetes`. All the fields are templates.
+type KubernetesConfig struct {
+	Image string
+	// Namespace defaults to the one of the kubeconfig context
+	Namespace      string
+	ServiceAccount string
+	// Kubeconfig defaults to $KUBECONFIG, ~/.kube/config, and the in-cluster config in this order
+	Kubeconfig string
+}
+
+func loadKubernetesConfig(raw map[interface{}]interface{}) *KubernetesConfig {
+	conf := &KubernetesConfig{}
+	for key, dst := range map[string]*string{
+		"image":          &conf.Image,
+		"namespace":      &conf.Namespace,
+		"serviceAccount": &conf.ServiceAccount,
+		"kubeconfig":     &conf.Kubeconfig,
+	} {
+		if v, ok := raw[key]; ok && v != nil {
+			*dst = fmt.Sprintf("%v", v)
+		}
+	}
+	return conf
+}
+
+var (
+	kubernetesPollInterval = time.Second
+	// kubernetesStartTimeout is how long to wait for the pod to be scheduled and its image to be pulled
+	kubernetesStartTimeout = 5 * time.Minute
+)
+
+const (
+	kubernetesScriptContainer = "script"
+	// kubernetesScriptKey is the key of the script in the secret. It's not a valid env var name, so that it never
+	// conflicts with the env vars in the secret.
+	kubernetesScriptKey = "variant-script"
+	kubernetesScriptDir = "/variant/script"
+)
+
+func (c KubernetesConfig) render(context ExecutionContext) (KubernetesConfig, error) {
+	var r KubernetesConfig
+	for _, f := range []struct {
+		name string
+		src  string
+		dst  *string
+	}{
+		{"image", c.Image, &r.Image},
+		{"namespace", c.Namespace, &r.Namespace},
+		{"serviceAccount", c.ServiceAccount, &r.ServiceAccount},
+		{"kubeconfig", c.Kubeconfig, &r.Kubeconfig},
+	} {
+		v, err := context.Render(f.src, "runner.kubernetes."+f.name)
+		if err != nil {
+			return r, err
+		}
+		*f.dst = strings.TrimSpace(v)
+	}
+	if r.Image == "" {
+		return r, fmt.Errorf("runner.kubernetes.image is required")
+	}
+	return r, nil
+}
+
+// kubernetesClient returns the client for the kubeconfig, and the namespace given or of the kubeconfig context
+func kubernetesClient(kubeconfig, namespace string) (kubernetes.Interface, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if kubeconfig != "" {
+		path, err := expandHome(kubeconfig)
+		if err != nil {
+			return nil, "", err
+		}
+		rules.ExplicitPath = path
+	}
+	overrides := &clientcmd.ConfigOverrides{}
+	overrides.Context.Namespace = namespace
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+	rest, err := config.ClientConfig()
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to load kubeconfig")
+	}
+	if namespace == "" {
+		namespace, _, err = config.Namespace()
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	client, err := kubernetes.NewForConfig(rest)
+	if err != nil {
+		return nil, "", err
+	}
+	return client, namespace, nil
+}
+
+var invalidPodNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// kubernetesStdoutWrapper runs the script given as the args, printing each line of its stdout after $0, the marker,
+// as it's written. Once the script exits, it prints the marker followed by the stdout as-is, which is kept in a file
+// so that binary outputs are returned intact. Pod logs have stdout and stderr merged, so this is how stdout is told
+// apart from stderr.
+const kubernetesStdoutWrapper = `out=$(mktemp) && status=$(mktemp) || exit
+{ "$@"; echo $? > "$status"; } | tee "$out" | while IFS= read -r line || [ -n "$line" ]; do printf '%s %s\n' "$0" "$line"; done
+printf '%s\n' "$0"
+cat "$out"
+exit "$(cat "$status")"`
+
+// podToRunScript returns the pod to run the script with the interpreter, and the secret of the same name holding the
+// script and the env vars, so that they don't show up in the pod spec. The script is mounted from the secret, and
+// its stdout is printed to the logs after the marker.
+func podToRunScript(conf KubernetesConfig, namespace, taskKey, script string, interpreter []string, ext string, env []string, workdir, marker string) (*corev1.Pod, *corev1.Secret) {
+	name := strings.Trim(invalidPodNameChars.ReplaceAllString(strings.ToLower(taskKey), "-"), "-")
+	if len(name) > 40 {
+		name = strings.TrimRight(name[:40], "-")
+	}
+
+	meta := metav1.ObjectMeta{
+		Name:      fmt.Sprintf("variant-%s-%s", name, utilrand.String(5)),
+		Namespace: namespace,
+		Labels:    map[string]string{"app.kubernetes.io/managed-by": "variant"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: meta,
+		Data:       map[string][]byte{kubernetesScriptKey: []byte(script)},
+	}
+
+	var vars []corev1.EnvVar
+	for _, e := range env {
+		kv := strings.SplitN(e, "=", 2)
+		secret.Data[kv[0]] = []byte(kv[1])
+		vars = append(vars, corev1.EnvVar{Name: kv[0], ValueFrom: &corev1.EnvVarSource{
+			SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: meta.Name}, Key: kv[0]},
+		}})
+	}
+
+	file := "script" + ext
+	return &corev1.Pod{
+		ObjectMeta: meta,
+		Spec: corev1.PodSpec{
+			RestartPolicy:      corev1.RestartPolicyNever,
+			ServiceAccountName: conf.ServiceAccount,
+			Containers: []corev1.Container{{
+				Name:  kubernetesScriptContainer,
+				Image: conf.Image,
+				// $@ is the interpreter followed by the file
+				Command:    []string{"sh", "-c", kubernetesStdoutWrapper, marker},
+				Args:       append(append([]string{}, interpreter...), kubernetesScriptDir+"/"+file),
+				Env:        vars,
+				WorkingDir: workdir,
+				VolumeMounts: []corev1.VolumeMount{{
+					Name:      kubernetesScriptContainer,
+					MountPath: kubernetesScriptDir,
+					ReadOnly:  true,
+				}},
+			}},
+			Volumes: []corev1.Volume{{
+				Name: kubernetesScriptContainer,
+				VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+					SecretName: meta.Name,
+					Items:      []corev1.KeyToPath{{Key: kubernetesScriptKey, Path: file}},
+				}},
+			}},
+		},
+	}, secret
+}
+
+// runScriptInKubernetes runs the script in a pod, streaming its stdout and stderr from the logs, and returns its stdout
+// printed to the logs after it exits. The pod and its secret are deleted afterwards, including when the run is
+// cancelled, or variant is interrupted with SIGINT or SIGTERM.
+func (t ScriptStep) runScriptInKubernetes(script string, env map[string]string, workdir string, context ExecutionContext) (string, error) {
+	runner := t.RunnerConfig
+	conf, err := runner.Kubernetes.render(context)
+	if err != nil {
+		return "", err
+	}
+
+	client, namespace := runner.kubeClient, conf.Namespace
+	if client == nil {
+		client, namespace, err = kubernetesClient(conf.Kubeconfig, conf.Namespace)
+		if err != nil {
+			return "", err
+		}
+	} else if namespace == "" {
+		namespace = metav1.NamespaceDefault
+	}
+
+	interpreter, ext, err := t.interpreter(script, context)
+	if err != nil {
+		return "", err
+	}
+	if interpreter == nil {
+		command := runner.Command
+		if command == "" {
+			command = "bash"
+		}
+		interpreter = append([]string{command}, runner.Args...)
+	}
+
+	envFiles, err := context.envFileVars()
+	if err != nil {
+		return "", err
+	}
+	var vars []string
+	for _, name := range envFiles.names() {
+		if _, ok := env[name]; !ok {
+			v, _ := envFiles.lookup(name)
+			vars = append(vars, fmt.Sprintf("%s=%s", name, v))
+		}
+	}
+	vars = append(vars, environ(env)...)
+	if traceparent := context.app.Tracing.Traceparent(); traceparent != "" {
+		vars = append(vars, fmt.Sprintf("%s=%s", TraceparentEnv, traceparent))
+	}
+
+	applog := log.StandardLogger().WithField("app", context.app.Name)
+	taskKey := context.Key().ShortString()
+	tasklog := applog.WithField("task", taskKey)
+
+	marker := fmt.Sprintf("variant.stdout.%s", utilrand.String(16))
+	pod, secret := podToRunScript(conf, namespace, taskKey, script, interpreter, ext, vars, workdir, marker)
+
+	applog.Infof("starting task %s", taskKey)
+	tasklog.Debugf("starting pod %s/%s", pod.Namespace, pod.Name)
+
+	span := context.app.Tracing.start(fmt.Sprintf("pod %s/%s", pod.Namespace, pod.Name), attrApp.String(context.app.Name), attrTask.String(taskKey), attrStep.String(t.GetName()), attrCommand.String(conf.Image))
+
+	// Cancelling the run deletes the pod as well as signals
+	ctx := context.app.ctx
+	if ctx == nil {
+		ctx = gocontext.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	output, exitStatus, err := t.runPod(ctx, client.CoreV1(), pod, secret, marker, context)
+	if err != nil {
+		if exitStatus >= 0 {
+			log.Errorf("exit status was %d", exitStatus)
+		}
+		tasklog.Errorf("script step failed: %v", err)
+		span.end(err, attrExitStatus.Int(exitStatus))
+		return output, errors.Wrap(err, "script step failed")
+	}
+	span.end(nil, attrExitStatus.Int(exitStatus))
+	return output, nil
+}
+
+// runPod creates the secret and the pod, and streams the logs until the pod exits or ctx is done. It returns the
+// stdout of the script, and the exit status of the script or -1 when the script didn't run.
+func (t ScriptStep) runPod(ctx gocontext.Context, client typedcorev1.CoreV1Interface, pod *corev1.Pod, secret *corev1.Secret, marker string, context ExecutionContext) (string, int, error) {
+	podSecrets, pods := client.Secrets(pod.Namespace), client.Pods(pod.Namespace)
+	// They're deleted with a context of their own, as ctx is done on cancellation and signals
+	propagation := metav1.DeletePropagationBackground
+	deleteOpts := metav1.DeleteOptions{PropagationPolicy: &propagation}
+
+	if _, err := podSecrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+		return "", -1, errors.Wrapf(err, "failed to create secret %s/%s", secret.Namespace, secret.Name)
+	}
+	defer func() {
+		if err := podSecrets.Delete(gocontext.Background(), secret.Name, deleteOpts); err != nil {
+			log.Errorf("failed to delete secret %s/%s: %v", secret.Namespace, secret.Name, err)
+		}
+	}()
+
+	created, err := pods.Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return "", -1, errors.Wrapf(err, "failed to create pod %s/%s", pod.Namespace, pod.Name)
+	}
+	defer func() {
+		if err := pods.Delete(gocontext.Background(), pod.Name, deleteOpts); err != nil {
+			log.Errorf("failed to delete pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}()
+
+	// Let the garbage collector delete the secret with the pod in case variant is killed before deleting them
+	secret.OwnerReferences = []metav1.OwnerReference{{APIVersion: "v1", Kind: "Pod", Name: created.Name, UID: created.UID}}
+	if _, err := podSecrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		log.Warnf("failed to set the owner of secret %s/%s: %v", secret.Namespace, secret.Name, err)
+	}
+
+	_, err = waitForPod(ctx, pods, pod.Name, kubernetesStartTimeout, func(p *corev1.Pod) (bool, error) {
+		for _, s := range p.Status.ContainerStatuses {
+			if w := s.State.Waiting; w != nil {
+				switch w.Reason {
+				case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError", "CreateContainerError":
+					return false, fmt.Errorf("pod %s/%s failed to start: %s: %s", p.Namespace, p.Name, w.Reason, w.Message)
+				}
+			}
+		}
+		return p.Status.Phase != corev1.PodPending, nil
+	})
+	if err != nil {
+		return "", -1, err
+	}
+
+	logs, err := pods.GetLogs(pod.Name, &corev1.PodLogOptions{Container: kubernetesScriptContainer, Follow: true}).Stream(ctx)
+	if err != nil {
+		return "", -1, errors.Wrapf(err, "failed to stream logs of pod %s/%s", pod.Namespace, pod.Name)
+	}
+	stdout, stderr, exactOutput := splitPodLogs(logs, marker)
+	resOut, _, err := t.streamOutput(stdout, stderr, context)
+	logs.Close()
+	if out, ok := exactOutput(); ok {
+		resOut = out
+	}
+	output := trimOutput(resOut)
+	if err != nil {
+		return output, -1, err
+	}
+
+	exited, err := waitForPod(ctx, pods, pod.Name, 0, func(p *corev1.Pod) (bool, error) {
+		return p.Status.Phase == corev1.PodSucceeded || p.Status.Phase == corev1.PodFailed, nil
+	})
+	if err != nil {
+		return output, -1, err
+	}
+	for _, s := range exited.Status.ContainerStatuses {
+		if s.Name == kubernetesScriptContainer && s.State.Terminated != nil {
+			code := int(s.State.Terminated.ExitCode)
+			if code != 0 {
+				return output, code, fmt.Errorf("pod %s/%s exited with status %d", pod.Namespace, pod.Name, code)
+			}
+			return output, code, nil
+		}
+	}
+	if exited.Status.Phase == corev1.PodFailed {
+		return output, -1, fmt.Errorf("pod %s/%s failed: %s", pod.Namespace, pod.Name, exited.Status.Message)
+	}
+	return output, 0, nil
+}
+
+// splitPodLogs splits the logs into the stderr and the stdout of the script streamed while it runs. The stdout printed
+// as-is after the script exits is returned by output once both readers are read, or false when it's not printed.
+func splitPodLogs(logs io.Reader, marker string) (io.Reader, io.Reader, func() (string, bool)) {
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+	var output bytes.Buffer
+	exited := false
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := readLines(logs, func(line string) {
+			if exited {
+				output.WriteString(line)
+				return
+			}
+			// The last line of stderr written before the marker may have no newline
+			if i := strings.Index(line, marker+" "); i >= 0 {
+				writeNonEmpty(stderrW, line[:i])
+				writeNonEmpty(stdoutW, line[i+len(marker)+1:])
+				return
+			}
+			if strings.HasSuffix(line, marker+"\n") {
+				writeNonEmpty(stderrW, strings.TrimSuffix(line, marker+"\n"))
+				exited = true
+				return
+			}
+			writeNonEmpty(stderrW, line)
+		})
+		stdoutW.CloseWithError(err)
+		stderrW.CloseWithError(err)
+	}()
+	return stdoutR, stderrR, func() (string, bool) {
+		<-done
+		return output.String(), exited
+	}
+}
+
+// writeNonEmpty writes the string unless it's empty, as writes to pipes block until they're read even when they're empty
+func writeNonEmpty(w io.Writer, s string) {
+	if s != "" {
+		w.Write([]byte(s))
+	}
+}
+
+// waitForPod polls the pod until the condition is met. It waits forever when the timeout is 0.
+func waitForPod(ctx gocontext.Context, pods typedcorev1.PodInterface, name string, timeout time.Duration, condition func(*corev1.Pod) (bool, error)) (*corev1.Pod, error) {
+	start := time.Now()
+	for {
+		pod, err := pods.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		ok, err := condition(pod)
+		if err != nil || ok {
+			return pod, err
+		}
+		if timeout > 0 && time.Since(start) > timeout {
+			return nil, fmt.Errorf("timed out waiting for pod %s/%s. It is %s", pod.Namespace, name, pod.Status.Phase)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(kubernetesPollInterval):
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package variant
+
+import (
+	gocontext "context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestScriptStepKubernetes(t *testing.T) {
+	defer func(interval time.Duration) { kubernetesPollInterval = interval }(kubernetesPollInterval)
+	kubernetesPollInterval = 0
+
+	task := &Task{
+		TaskDef:     TaskDef{Env: map[string]string{"TARGET": "{{ .target }}"}},
+		Name:        TaskName{Components: []string{"mycmd", "db.migrate"}},
+		ProjectName: "mycmd",
+	}
+	registry := NewTaskRegistry()
+	registry.put(task.Name, task)
+	tmpl := NewTaskTemplate(task, map[string]interface{}{"target": "prod"})
+	context := NewStepExecutionContext(Application{TaskRegistry: registry}, TaskRunner{Task: task, Template: tmpl}, tmpl, true, nil)
+
+	var created *corev1.Pod
+	exitCode := int32(0)
+	pending := false
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		created = action.(k8stesting.CreateAction).GetObject().(*corev1.Pod)
+		created.Status = corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				Name:  kubernetesScriptContainer,
+				State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode}},
+			}},
+		}
+		if exitCode != 0 {
+			created.Status.Phase = corev1.PodFailed
+		}
+		if pending {
+			created.Status = corev1.PodStatus{Phase: corev1.PodPending}
+		}
+		// Let the tracker store the pod
+		return false, nil, nil
+	})
+
+	step, err := ScriptStepLoader{}.LoadStep(NewStepDef(map[string]interface{}{
+		"name":   "script",
+		"script": "echo migrating $TARGET",
+		"runner": map[string]interface{}{"kubernetes": map[interface{}]interface{}{
+			"image":          "postgres:12",
+			"namespace":      "db-{{ .target }}",
+			"serviceAccount": "migrator",
+		}},
+	}), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := step.(ScriptStep)
+	s.RunnerConfig.kubeClient = client
+
+	output, err := s.Run(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fake clientset always returns "fake logs", which has no marker to print stdout after
+	if output.String != "" {
+		t.Errorf("unexpected output: %q", output.String)
+	}
+
+	if created.Namespace != "db-prod" || created.Spec.ServiceAccountName != "migrator" || !strings.HasPrefix(created.Name, "variant-db-migrate-") {
+		t.Errorf("unexpected pod: %s/%s with service account %q", created.Namespace, created.Name, created.Spec.ServiceAccountName)
+	}
+	container := created.Spec.Containers[0]
+	if expected := []string{"bash", "/variant/script/script.sh"}; container.Image != "postgres:12" || !reflect.DeepEqual(container.Args, expected) {
+		t.Errorf("unexpected container: %s %q", container.Image, container.Args)
+	}
+	ref := &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: created.Name}, Key: "TARGET"}
+	if len(container.Env) != 1 || container.Env[0].Value != "" || !reflect.DeepEqual(container.Env[0].ValueFrom.SecretKeyRef, ref) {
+		t.Errorf("unexpected env: %v", container.Env)
+	}
+	if volume := created.Spec.Volumes[0].Secret; volume.SecretName != created.Name || volume.Items[0].Key != kubernetesScriptKey {
+		t.Errorf("unexpected volume: %v", volume)
+	}
+
+	assertDeleted := func() {
+		t.Helper()
+		pods, err := client.CoreV1().Pods("db-prod").List(gocontext.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pods.Items) != 0 {
+			t.Errorf("pod not deleted: %v", pods.Items)
+		}
+		secrets, err := client.CoreV1().Secrets("db-prod").List(gocontext.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(secrets.Items) != 0 {
+			t.Errorf("secret not deleted: %v", secrets.Items)
+		}
+	}
+	assertDeleted()
+
+	var secret *corev1.Secret
+	// The owner is set by updating the secret after the pod is created
+	client.PrependReactor("update", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		secret = action.(k8stesting.UpdateAction).GetObject().(*corev1.Secret)
+		return false, nil, nil
+	})
+	if _, err := s.Run(context); err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string][]byte{"TARGET": []byte("prod"), kubernetesScriptKey: []byte("echo migrating $TARGET")}; !reflect.DeepEqual(secret.Data, expected) {
+		t.Errorf("unexpected secret: %v", secret.Data)
+	}
+	if owner := secret.OwnerReferences; len(owner) != 1 || owner[0].Kind != "Pod" || owner[0].Name != created.Name {
+		t.Errorf("unexpected owner of the secret: %v", owner)
+	}
+
+	// Signals cancel the context, and the pod and the secret are deleted while the pod is pending
+	pending = true
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	pod, secret := podToRunScript(KubernetesConfig{Image: "postgres:12"}, "db-prod", "db.migrate", "echo", []string{"sh"}, ".sh", nil, "", "marker")
+	if _, _, err := s.runPod(ctx, client.CoreV1(), pod, secret, "marker", context); err != gocontext.Canceled {
+		t.Errorf("unexpected error: %v", err)
+	}
+	assertDeleted()
+
+	// So does cancelling the run
+	ctx, cancel = gocontext.WithCancel(gocontext.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	cancellable := NewStepExecutionContext(Application{TaskRegistry: registry, ctx: ctx}, TaskRunner{Task: task, Template: tmpl}, tmpl, true, nil)
+	if _, err := s.Run(cancellable); err == nil || !strings.HasSuffix(err.Error(), gocontext.Canceled.Error()) {
+		t.Errorf("unexpected error: %v", err)
+	}
+	assertDeleted()
+	pending = false
+
+	exitCode = 3
+	if _, err := s.Run(context); err == nil || !strings.HasSuffix(err.Error(), "exited with status 3") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestSplitPodLogs(t *testing.T) {
+	marker := "variant.stdout.abc"
+	logs := "warning\nno newline" + marker + " live\n" + marker + " result\n" + "error\n" + marker + "\nresult\n\x00\xff"
+	stdout, stderr, output := splitPodLogs(strings.NewReader(logs), marker)
+	var out, errOut []byte
+	done := make(chan struct{})
+	go func() {
+		errOut, _ = ioutil.ReadAll(stderr)
+		close(done)
+	}()
+	out, err := ioutil.ReadAll(stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if string(out) != "live\nresult\n" || string(errOut) != "warning\nno newlineerror\n" {
+		t.Errorf("unexpected stdout %q and stderr %q", out, errOut)
+	}
+	if exact, ok := output(); !ok || exact != "result\n\x00\xff" {
+		t.Errorf("unexpected output: %q, %v", exact, ok)
+	}
+
+	_, stderr, output = splitPodLogs(strings.NewReader("killed\n"), marker)
+	ioutil.ReadAll(stderr)
+	if _, ok := output(); ok {
+		t.Error("the output must be missing when the script didn't exit")
+	}
+}
@@ -0,0 +1,197 @@
+package variant
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// rawOutput is the `output` to write the stdout of the script as-is to `outputFile` or the stdout, instead of
+// capturing it as the output of the step
+const rawOutput = "raw"
+
+// openRawOutput opens the rendered `outputFile`, or returns the stdout when it's empty.
+// The returned func closes the file.
+func (s ScriptStep) openRawOutput(context ExecutionContext) (io.Writer, func() error, error) {
+	if s.OutputFile == "" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	path, err := context.Render(s.OutputFile, "outputFile")
+	if err != nil {
+		return nil, nil, err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, nil, err
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to open outputFile")
+	}
+	return f, f.Close, nil
+}
+
+// streamOutput forwards the lines of the stdout and stderr of a script to the user and the event stream, until both
+// of them are closed. It returns the stdout as-is except the lines sent to stderr with the `variant.stderr: ` prefix,
+// and the lines of stderr. The stdout is copied to the raw output instead when it's set.
+func (t ScriptStep) streamOutput(stdout, stderr io.Reader, context ExecutionContext) (string, string, error) {
+	tasklog := log.StandardLogger().WithField("app", context.app.Name).WithField("task", context.Key().ShortString())
+	taskKey := context.Key().ShortString()
+	errOut := ""
+
+	channels := struct {
+		Stdout chan string
+		Stderr chan string
+	}{
+		Stdout: make(chan string),
+		Stderr: make(chan string),
+	}
+
+	// Written by the goroutines, and read after the channels are closed
+	var captured bytes.Buffer
+	var stdoutErr, stderrErr error
+
+	// Stderr is closed after both, as the lines of stdout with the prefix are sent to it
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		readers.Wait()
+		close(channels.Stderr)
+	}()
+
+	go func() {
+		defer func() {
+			close(channels.Stdout)
+			readers.Done()
+		}()
+		if t.rawOutput != nil {
+			_, stdoutErr = io.Copy(t.rawOutput, stdout)
+			return
+		}
+		stdoutErr = readLines(stdout, func(line string) {
+			text := trimNewline(line)
+			errOutPrefix := "variant.stderr: "
+			if strings.HasPrefix(text, errOutPrefix) {
+				channels.Stderr <- strings.TrimPrefix(text, errOutPrefix)
+			} else {
+				captured.WriteString(line)
+				channels.Stdout <- text
+			}
+		})
+	}()
+
+	go func() {
+		defer readers.Done()
+		stderrErr = readLines(stderr, func(line string) {
+			channels.Stderr <- trimNewline(line)
+		})
+	}()
+
+	stdoutEnds := false
+	stderrEnds := false
+
+	var writeToOut func(str string)
+	var writeToErr func(str string)
+
+	// Print logs to stdout and stderr only when this is the command called by the user, directly or indirectly, as a task script. not as an input
+	if !context.asInput {
+		writeToOut = func(str string) {
+			fmt.Fprint(os.Stdout, secrets.Mask(str), "\n")
+		}
+		writeToErr = func(str string) {
+			tasklog.Warn(str)
+		}
+	} else {
+		writeToOut = func(str string) {
+			tasklog.Info(str)
+		}
+		writeToErr = func(str string) {
+			tasklog.Warn(str)
+		}
+	}
+
+	lineEvent := Event{App: context.app.Name, Task: taskKey, Step: t.GetName()}
+	emitLine := func(tpe EventType, write func(string)) func(string) {
+		return func(str string) {
+			write(str)
+			e := lineEvent
+			e.Type = tpe
+			e.Line = str
+			context.app.Events.Emit(e)
+		}
+	}
+	writeToOut = emitLine(EventScriptStdout, writeToOut)
+	writeToErr = emitLine(EventScriptStderr, writeToErr)
+
+	// Coordinating stdout/stderr in this single place to not screw up message ordering
+	for {
+		select {
+		case text, ok := <-channels.Stdout:
+			if ok {
+				writeToOut(text)
+			} else {
+				stdoutEnds = true
+			}
+		case text, ok := <-channels.Stderr:
+			if ok {
+				writeToErr(text)
+				if errOut != "" {
+					errOut += "\n"
+				}
+				errOut += text
+			} else {
+				stderrEnds = true
+			}
+		}
+		if stdoutEnds && stderrEnds {
+			break
+		}
+	}
+
+	if stdoutErr != nil {
+		return captured.String(), errOut, errors.Wrapf(stdoutErr, "failed to read the stdout of the script")
+	}
+	if stderrErr != nil {
+		return captured.String(), errOut, errors.Wrapf(stderrErr, "failed to read the stderr of the script")
+	}
+	return captured.String(), errOut, nil
+}
+
+// readLines calls f with each line read from r including the trailing newline, without limiting the length of lines
+func readLines(r io.Reader, f func(line string)) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			f(line)
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func trimNewline(line string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+}
+
+// trimOutput trims the leading and trailing newlines and spaces of the output of a script as text.
+// Binary outputs, which aren't valid UTF-8, are returned as-is.
+func trimOutput(out string) string {
+	if !utf8.ValidString(out) {
+		return out
+	}
+	return strings.Trim(out, "\r\n ")
+}
@@ -0,0 +1,84 @@
+package variant
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/pkg/errors"
+)
+
+func TestScriptStepOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-output-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	task := &Task{
+		Name:        TaskName{Components: []string{"mycmd", "export"}},
+		ProjectName: "mycmd",
+	}
+	registry := NewTaskRegistry()
+	registry.put(task.Name, task)
+	tmpl := NewTaskTemplate(task, map[string]interface{}{"dir": dir})
+	context := NewStepExecutionContext(Application{TaskRegistry: registry}, TaskRunner{Task: task, Template: tmpl}, tmpl, true, nil)
+
+	loadStep := func(def map[string]interface{}) ScriptStep {
+		def["name"] = "script"
+		step, err := ScriptStepLoader{}.LoadStep(NewStepDef(def), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return step.(ScriptStep)
+	}
+
+	longLine := strings.Repeat("a", 200000)
+	testcases := []struct {
+		script   string
+		expected string
+	}{
+		// Longer than the 64KiB limit of bufio.Scanner
+		{script: "printf '%s\\n' " + longLine, expected: longLine},
+		{script: "printf 'a\\r\\nb\\r\\n\\n'", expected: "a\r\nb"},
+		{script: "printf 'a\\nvariant.stderr: b\\nc'", expected: "a\nc"},
+		// Binary outputs are kept as-is, including the trailing newline
+		{script: "printf '\\037\\213\\000\\377\\n'", expected: "\x1f\x8b\x00\xff\n"},
+	}
+	for _, tc := range testcases {
+		output, err := loadStep(map[string]interface{}{"script": tc.script}).Run(context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if output.String != tc.expected {
+			t.Errorf("unexpected output of %s: %q", tc.script[:20], output.String)
+		}
+	}
+
+	output, err := loadStep(map[string]interface{}{
+		"script":     "printf '\\037\\213\\000\\377\\n'",
+		"output":     "raw",
+		"outputFile": "{{ .dir }}/dist/app.tgz",
+	}).Run(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.String != "" {
+		t.Errorf("raw output should not be captured: %q", output.String)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(dir, "dist/app.tgz")); string(content) != "\x1f\x8b\x00\xff\n" {
+		t.Errorf("unexpected content of outputFile: %q", content)
+	}
+
+	if _, err := (ScriptStepLoader{}).LoadStep(NewStepDef(map[string]interface{}{"name": "script", "script": "echo", "output": "json"}), nil); err == nil {
+		t.Error("expected an error for the unsupported output")
+	}
+
+	_, _, err = ScriptStep{}.streamOutput(iotest.ErrReader(errors.New("broken pipe")), strings.NewReader(""), context)
+	if err == nil || err.Error() != "failed to read the stdout of the script: broken pipe" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
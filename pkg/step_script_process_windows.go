@@ -0,0 +1,13 @@
+package variant
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup is a no-op, as Windows has no process groups to kill at once
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,433 @@
+package variant
+
+import (
+	gocontext "context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHConfig is the remote host to run the script on, via `runner.ssh`. All the fields are templates.
+type SSHConfig struct {
+	Host string
+	User string
+	Port string
+	// IdentityFile is the private key to authenticate with. The ssh agent and the default keys in ~/.ssh are used when empty
+	IdentityFile string
+	// KnownHosts is the known_hosts file to verify the host key with. Defaults to ~/.ssh/known_hosts
+	KnownHosts string
+}
+
+// sshTerminationTimeout is how long to wait for the remote script to exit on SIGTERM before closing the session
+var sshTerminationTimeout = 10 * time.Second
+
+func loadSSHConfig(raw map[interface{}]interface{}) *SSHConfig {
+	conf := &SSHConfig{}
+	for key, dst := range map[string]*string{
+		"host":         &conf.Host,
+		"user":         &conf.User,
+		"port":         &conf.Port,
+		"identityFile": &conf.IdentityFile,
+		"knownHosts":   &conf.KnownHosts,
+	} {
+		if v, ok := raw[key]; ok && v != nil {
+			*dst = fmt.Sprintf("%v", v)
+		}
+	}
+	return conf
+}
+
+// sshTarget is the SSHConfig with the templates rendered and the defaults filled
+type sshTarget struct {
+	host, user, port, identityFile, knownHosts string
+}
+
+func (c SSHConfig) target(context ExecutionContext) (sshTarget, error) {
+	var t sshTarget
+	for _, f := range []struct {
+		name string
+		src  string
+		dst  *string
+	}{
+		{"host", c.Host, &t.host},
+		{"user", c.User, &t.user},
+		{"port", c.Port, &t.port},
+		{"identityFile", c.IdentityFile, &t.identityFile},
+		{"knownHosts", c.KnownHosts, &t.knownHosts},
+	} {
+		r, err := context.Render(f.src, "runner.ssh."+f.name)
+		if err != nil {
+			return t, err
+		}
+		*f.dst = strings.TrimSpace(r)
+	}
+	if t.host == "" {
+		return t, fmt.Errorf("runner.ssh.host is required")
+	}
+	if t.port == "" {
+		t.port = "22"
+	}
+	if t.user == "" {
+		u, err := user.Current()
+		if err != nil {
+			return t, errors.Wrapf(err, "runner.ssh.user is required, as the current user is unknown")
+		}
+		t.user = u.Username
+	}
+	if t.knownHosts == "" {
+		t.knownHosts = "~/.ssh/known_hosts"
+	}
+	return t, nil
+}
+
+func (t sshTarget) String() string {
+	return fmt.Sprintf("%s@%s", t.user, net.JoinHostPort(t.host, t.port))
+}
+
+func (t sshTarget) dial() (*ssh.Client, error) {
+	knownHosts, err := expandHome(t.knownHosts)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := knownhosts.New(knownHosts)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read known hosts")
+	}
+	auth, err := t.authMethods()
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.Dial("tcp", net.JoinHostPort(t.host, t.port), &ssh.ClientConfig{
+		User:            t.user,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %s", t)
+	}
+	return client, nil
+}
+
+// authMethods returns the key of the identityFile, or the ssh agent and the default keys
+func (t sshTarget) authMethods() ([]ssh.AuthMethod, error) {
+	if t.identityFile != "" {
+		path, err := expandHome(t.identityFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := readSSHKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		} else {
+			log.Debugf("ignoring the ssh agent: %v", err)
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		path, err := expandHome(filepath.Join("~/.ssh", name))
+		if err != nil {
+			break
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		signer, err := readSSHKey(path)
+		if err != nil {
+			log.Debugf("ignoring %s: %v", path, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("no ssh key found for %s. Set runner.ssh.identityFile, or run an ssh agent", t)
+	}
+	return methods, nil
+}
+
+func readSSHKey(path string) (ssh.Signer, error) {
+	bs, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read ssh key")
+	}
+	signer, err := ssh.ParsePrivateKey(bs)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok {
+		return nil, fmt.Errorf("ssh key %s is protected with a passphrase. Add it to the ssh agent instead", path)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse ssh key %s", path)
+	}
+	return signer, nil
+}
+
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// terminateOnCancel sends SIGTERM to the remote command of the session once ctx is done, until the returned func is
+// called. The session is closed as well, so that the run isn't kept waiting on servers ignoring signals.
+func terminateOnCancel(ctx gocontext.Context, session *ssh.Session) func() {
+	if ctx == nil {
+		return func() {}
+	}
+	done := make(chan struct{})
+	timeout := sshTerminationTimeout
+	go func() {
+		select {
+		case <-ctx.Done():
+			if err := session.Signal(ssh.SIGTERM); err != nil {
+				log.Errorf("failed to terminate the remote script: %v", err)
+			}
+			select {
+			case <-done:
+			case <-time.After(timeout):
+				session.Close()
+			}
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// shellQuote quotes the string for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = shellQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// sshUpload writes the content to the file at the remote path, readable only by the user
+func sshUpload(client *ssh.Client, path string, content io.Reader) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	session.Stdin = content
+	if out, err := session.CombinedOutput("umask 077 && cat > " + shellQuote(path)); err != nil {
+		return errors.Wrapf(err, "failed to upload %s: %s", path, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// sshRemove removes the remote directory
+func sshRemove(client *ssh.Client, path string) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	if out, err := session.CombinedOutput("rm -rf " + shellQuote(path)); err != nil {
+		return errors.Wrapf(err, "%s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// runScriptOverSSH uploads the script and the tarballs of the artifacts to a temporary directory on the remote host,
+// and runs the script there with the env, streaming its stdout and stderr like local scripts
+func (t ScriptStep) runScriptOverSSH(script string, env map[string]string, workdir string, context ExecutionContext) (string, error) {
+	target, err := t.RunnerConfig.SSH.target(context)
+	if err != nil {
+		return "", err
+	}
+
+	applog := log.StandardLogger().WithField("app", context.app.Name)
+	taskKey := context.Key().ShortString()
+	tasklog := applog.WithField("task", taskKey)
+
+	applog.Infof("starting task %s", taskKey)
+	tasklog.Debugf("connecting to %s", target)
+
+	span := context.app.Tracing.start(fmt.Sprintf("ssh %s", target.host), attrApp.String(context.app.Name), attrTask.String(taskKey), attrStep.String(t.GetName()), attrCommand.String("ssh"))
+
+	output, err := t.runScriptOnClient(script, target, env, workdir, context)
+	if err != nil {
+		exitStatus := -1
+		if exitError, ok := errors.Cause(err).(*ssh.ExitError); ok {
+			exitStatus = exitError.ExitStatus()
+			log.Errorf("exit status was %d", exitStatus)
+		}
+		tasklog.Errorf("script step failed: %v", err)
+		span.end(err, attrExitStatus.Int(exitStatus))
+		return output, errors.Wrap(err, "script step failed")
+	}
+	span.end(nil, attrExitStatus.Int(0))
+	return output, nil
+}
+
+func (t ScriptStep) runScriptOnClient(script string, target sshTarget, env map[string]string, workdir string, context ExecutionContext) (string, error) {
+	runner := t.RunnerConfig
+
+	interpreter, ext, err := t.interpreter(script, context)
+	if err != nil {
+		return "", err
+	}
+	if interpreter == nil {
+		command := runner.Command
+		if command == "" {
+			command = "bash"
+		}
+		interpreter = append([]string{command}, runner.Args...)
+	}
+
+	var tarballs []string
+	if len(runner.Artifacts) > 0 {
+		staging, err := ioutil.TempDir("", "variant-artifacts")
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(staging)
+		tarballs, err = runner.transferArtifacts(staging, context)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	client, err := target.dial()
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	out, err := session.Output(`mktemp -d "${TMPDIR:-/tmp}/variant.XXXXXXXX"`)
+	session.Close()
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create a temporary directory on %s", target)
+	}
+	tmp := strings.TrimSpace(string(out))
+	// Removed even when uploads fail, as the script may contain secrets
+	defer func() {
+		if err := sshRemove(client, tmp); err != nil {
+			log.Errorf("failed to remove %s on %s: %v", tmp, target, err)
+		}
+	}()
+
+	scriptFile := tmp + "/script" + ext
+	if err := sshUpload(client, scriptFile, strings.NewReader(script)); err != nil {
+		return "", err
+	}
+
+	var commands []string
+	if workdir != "" {
+		commands = append(commands, "cd "+shellQuote(workdir))
+	}
+	for i, tarball := range tarballs {
+		remote := fmt.Sprintf("%s/artifact-%d.tgz", tmp, i)
+		f, err := os.Open(tarball)
+		if err != nil {
+			return "", err
+		}
+		err = sshUpload(client, remote, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+		commands = append(commands, fmt.Sprintf("tar zxvf %s 1>&2", shellQuote(remote)))
+	}
+
+	// Sessions don't accept most variables via setenv by default, and variables in the command are visible to the
+	// other users of the remote host via `ps`, hence the file sourced before running the script
+	vars := map[string]string{}
+	envFiles, err := context.envFileVars()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range envFiles.names() {
+		vars[name], _ = envFiles.lookup(name)
+	}
+	for k, v := range env {
+		vars[k] = v
+	}
+	if traceparent := context.app.Tracing.Traceparent(); traceparent != "" {
+		vars[TraceparentEnv] = traceparent
+	}
+	if len(vars) > 0 {
+		var exports strings.Builder
+		for _, name := range sortedKeys(vars) {
+			fmt.Fprintf(&exports, "export %s=%s\n", name, shellQuote(vars[name]))
+		}
+		envFile := tmp + "/env"
+		if err := sshUpload(client, envFile, strings.NewReader(exports.String())); err != nil {
+			return "", err
+		}
+		commands = append(commands, ". "+shellQuote(envFile))
+	}
+	// exec, so that the signal to cancel the run is sent to the script instead of the shell running it
+	commands = append(commands, "exec "+shellJoin(append(interpreter, scriptFile)))
+
+	command := strings.Join(commands, " && ")
+
+	session, err = client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	if context.Interactive() {
+		session.Stdin = os.Stdin
+		session.Stdout = os.Stdout
+		session.Stderr = os.Stderr
+		return "", session.Run(command)
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	stderr, err := session.StderrPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := session.Start(command); err != nil {
+		return "", err
+	}
+	stopSignaling := terminateOnCancel(context.app.ctx, session)
+	resOut, errOut, streamErr := t.streamOutput(stdout, stderr, context)
+	err = session.Wait()
+	stopSignaling()
+	if err != nil {
+		return strings.Trim(errOut, "\n "), err
+	}
+	if streamErr != nil {
+		return strings.Trim(errOut, "\n "), streamErr
+	}
+	return trimOutput(resOut), nil
+}
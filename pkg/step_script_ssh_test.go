@@ -0,0 +1,265 @@
+package variant
+
+import (
+	gocontext "context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startSSHServer starts a server running the commands of exec requests with `sh -c` on the local host, calling
+// executed with each command before running it
+func startSSHServer(t *testing.T, authorized ssh.PublicKey, executed func(command string)) (net.Listener, ssh.PublicKey) {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(authorized.Marshal()) {
+				return nil, os.ErrPermission
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChannel := range chans {
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+					go func() {
+						defer channel.Close()
+						for req := range requests {
+							if req.Type != "exec" {
+								req.Reply(false, nil)
+								continue
+							}
+							req.Reply(true, nil)
+							executed(string(req.Payload[4:]))
+							cmd := exec.Command("sh", "-c", string(req.Payload[4:]))
+							cmd.Stdin, cmd.Stdout, cmd.Stderr = channel, channel, channel.Stderr()
+							status := make([]byte, 4)
+							err := cmd.Start()
+							if err == nil {
+								// Signals are sent to the command, as sshd does
+								go func() {
+									for req := range requests {
+										if req.Type == "signal" {
+											cmd.Process.Signal(syscall.SIGTERM)
+										}
+									}
+								}()
+								err = cmd.Wait()
+							}
+							if err != nil {
+								if exitErr, ok := err.(*exec.ExitError); ok {
+									binary.BigEndian.PutUint32(status, uint32(exitErr.ExitCode()))
+								} else {
+									binary.BigEndian.PutUint32(status, 255)
+								}
+							}
+							channel.SendRequest("exit-status", false, status)
+							return
+						}
+					}()
+				}
+			}()
+		}
+	}()
+	return listener, hostSigner.PublicKey()
+}
+
+func TestScriptStepSSH(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-ssh-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identityFile := filepath.Join(dir, "id_ecdsa")
+	if err := ioutil.WriteFile(identityFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	clientPub, err := ssh.NewPublicKey(&clientKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The server runs commands with the env of the test, so this is the TMPDIR on the remote host
+	remoteTmp := filepath.Join(dir, "tmp")
+	if err := os.Mkdir(remoteTmp, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(tmpdir string) { os.Setenv("TMPDIR", tmpdir) }(os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", remoteTmp)
+
+	var mu sync.Mutex
+	var commands []string
+	listener, hostPub := startSSHServer(t, clientPub, func(command string) {
+		mu.Lock()
+		defer mu.Unlock()
+		commands = append(commands, command)
+	})
+	defer listener.Close()
+	addr := listener.Addr().(*net.TCPAddr)
+
+	knownHosts := filepath.Join(dir, "known_hosts")
+	if err := ioutil.WriteFile(knownHosts, []byte(knownhosts.Line([]string{knownhosts.Normalize(addr.String())}, hostPub)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	task := &Task{
+		TaskDef:     TaskDef{Env: map[string]string{"GREETING": "it's {{ .name }}"}},
+		Name:        TaskName{Components: []string{"mycmd", "deploy"}},
+		ProjectName: "mycmd",
+	}
+	registry := NewTaskRegistry()
+	registry.put(task.Name, task)
+	tmpl := NewTaskTemplate(task, map[string]interface{}{"name": "remote"})
+	context := NewStepExecutionContext(Application{TaskRegistry: registry}, TaskRunner{Task: task, Template: tmpl}, tmpl, true, nil)
+
+	loadStep := func(script string, ssh map[interface{}]interface{}) ScriptStep {
+		step, err := ScriptStepLoader{}.LoadStep(NewStepDef(map[string]interface{}{
+			"name":   "script",
+			"script": script,
+			"runner": map[string]interface{}{"ssh": ssh},
+		}), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return step.(ScriptStep)
+	}
+	ssh := map[interface{}]interface{}{
+		"host":         "{{ .name | replace \"remote\" \"127.0.0.1\" }}",
+		"port":         addr.Port,
+		"user":         "deploy",
+		"identityFile": identityFile,
+		"knownHosts":   knownHosts,
+	}
+
+	step := loadStep("echo \"$GREETING\"\necho error >&2\n", ssh)
+	step.Workdir = dir
+	output, err := step.Run(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.String != "it's remote" {
+		t.Errorf("unexpected output: %q", output.String)
+	}
+
+	// The env is sourced from a file only the user can read, instead of being visible in the command via `ps`
+	mu.Lock()
+	for _, c := range commands {
+		if strings.Contains(c, "GREETING") {
+			t.Errorf("the env is in the command: %s", c)
+		}
+	}
+	mu.Unlock()
+	if output, err = loadStep(`ls -l "$(dirname "$0")/env" | cut -c1-10`, ssh).Run(context); err != nil {
+		t.Fatal(err)
+	}
+	if output.String != "-rw-------" {
+		t.Errorf("unexpected mode of the env file: %q", output.String)
+	}
+
+	remote := filepath.Join(dir, "remote")
+	if err := os.Mkdir(remote, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "artifact.txt"), []byte("built"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	step = loadStep("find . -name artifact.txt | xargs cat", ssh)
+	step.Workdir = remote
+	step.RunnerConfig.Artifacts = []Artifact{{Name: "app", Path: filepath.Join(dir, "artifact.txt"), Via: "file://" + filepath.Join(dir, "store")}}
+	if output, err = step.Run(context); err != nil {
+		t.Fatal(err)
+	}
+	if output.String != "built" {
+		t.Errorf("unexpected output with the artifact: %q", output.String)
+	}
+
+	output, err = loadStep("echo failed >&2; exit 3", ssh).Run(context)
+	if err == nil || !strings.Contains(err.Error(), "exited with status 3") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if output.String != "failed" {
+		t.Errorf("unexpected output: %q", output.String)
+	}
+	if left, _ := ioutil.ReadDir(remoteTmp); len(left) != 0 {
+		t.Errorf("temporary directories left on the remote host: %v", left)
+	}
+
+	// Cancelling the run terminates the remote script
+	defer func(timeout time.Duration) { sshTerminationTimeout = timeout }(sshTerminationTimeout)
+	sshTerminationTimeout = 100 * time.Millisecond
+	ctx, cancel := gocontext.WithCancel(gocontext.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	cancellable := NewStepExecutionContext(Application{TaskRegistry: registry, ctx: ctx}, TaskRunner{Task: task, Template: tmpl}, tmpl, true, nil)
+	started := time.Now()
+	if _, err := loadStep("exec sleep 30", ssh).Run(cancellable); err == nil {
+		t.Error("expected error, but succeeded")
+	}
+	if d := time.Since(started); d > 5*time.Second {
+		t.Errorf("the remote script kept running for %s after the run is cancelled", d)
+	}
+	if left, _ := ioutil.ReadDir(remoteTmp); len(left) != 0 {
+		t.Errorf("temporary directories left on the remote host after cancelling: %v", left)
+	}
+
+	ssh["knownHosts"] = filepath.Join(dir, "empty_known_hosts")
+	ioutil.WriteFile(ssh["knownHosts"].(string), nil, 0644)
+	if _, err := loadStep("echo", ssh).Run(context); err == nil || !strings.Contains(err.Error(), "key is unknown") {
+		t.Errorf("unexpected error for the unknown host: %v", err)
+	}
+}
@@ -7,21 +7,28 @@ import (
 
 	"github.com/mumoshu/variant/pkg/get"
 	"github.com/mumoshu/variant/pkg/util/maputil"
+	"gopkg.in/yaml.v2"
+	"path/filepath"
 	"strings"
 )
 
 type TaskDef struct {
-	Name              string       `yaml:"name,omitempty"`
-	Description       string       `yaml:"description,omitempty"`
-	Inputs            InputConfigs `yaml:"inputs,omitempty"`
-	TaskDefs          TaskDefs     `yaml:"tasks,omitempty"`
-	Script            string       `yaml:"script,omitempty"`
-	Steps             []Step       `yaml:"steps,omitempty"`
-	Autoenv           bool         `yaml:"autoenv,omitempty"`
-	Autodir           bool         `yaml:"autodir,omitempty"`
-	BindParamsFromEnv bool         `yaml:"bindParamsFromEnv,omitempty"`
-	Interactive       bool         `yaml:"interactive,omitempty"`
-	Private           bool         `yaml:"private,omitempty"`
+	Name              string            `yaml:"name,omitempty"`
+	Description       string            `yaml:"description,omitempty"`
+	Inputs            InputConfigs      `yaml:"inputs,omitempty"`
+	TaskDefs          TaskDefs          `yaml:"tasks,omitempty"`
+	Script            string            `yaml:"script,omitempty"`
+	Steps             []Step            `yaml:"steps,omitempty"`
+	Autoenv           bool              `yaml:"autoenv,omitempty"`
+	Autodir           bool              `yaml:"autodir,omitempty"`
+	BindParamsFromEnv bool              `yaml:"bindParamsFromEnv,omitempty"`
+	Interactive       bool              `yaml:"interactive,omitempty"`
+	Private           bool              `yaml:"private,omitempty"`
+	Confirm           *ConfirmConfig    `yaml:"confirm,omitempty"`
+	EnvFiles          []string          `yaml:"envFiles,omitempty"`
+	Env               map[string]string `yaml:"env,omitempty"`
+	Workdir           string            `yaml:"workdir,omitempty"`
+	Shell             string            `yaml:"shell,omitempty"`
 
 	fun func(ctx ExecutionContext) (string, error)
 }
@@ -55,12 +62,19 @@ type TaskDefV1 struct {
 	TaskDefs    []*TaskDef                    `yaml:"tasks,omitempty"`
 	Runner      map[string]interface{}        `yaml:"runner,omitempty"`
 	Script      string                        `yaml:"script,omitempty"`
+	ScriptFile  string                        `yaml:"scriptFile,omitempty"`
+	Template    bool                          `yaml:"template,omitempty"`
 	StepDefs    []map[interface{}]interface{} `yaml:"steps,omitempty"`
 	Autoenv     bool                          `yaml:"autoenv,omitempty"`
 	Autodir     bool                          `yaml:"autodir,omitempty"`
 	BindEnvVar  bool                          `yaml:"bindParamsFromEnv,omitempty"`
 	Interactive bool                          `yaml:"interactive,omitempty"`
 	Private     bool                          `yaml:"private,omitempty"`
+	Confirm     *ConfirmConfig                `yaml:"confirm,omitempty"`
+	EnvFiles    []string                      `yaml:"envFiles,omitempty"`
+	Env         map[string]string             `yaml:"env,omitempty"`
+	Workdir     string                        `yaml:"workdir,omitempty"`
+	Shell       string                        `yaml:"shell,omitempty"`
 }
 
 type TaskDefV2 struct {
@@ -72,12 +86,23 @@ type TaskDefV2 struct {
 	TaskDefs    map[string]*TaskDef           `yaml:"tasks,omitempty"`
 	Runner      map[string]interface{}        `yaml:"runner,omitempty"`
 	Script      interface{}                   `yaml:"script,omitempty"`
+	ScriptFile  string                        `yaml:"scriptFile,omitempty"`
+	Template    bool                          `yaml:"template,omitempty"`
 	StepDefs    []map[interface{}]interface{} `yaml:"steps,omitempty"`
 	Autoenv     bool                          `yaml:"autoenv,omitempty"`
 	Autodir     bool                          `yaml:"autodir,omitempty"`
 	BindEnvVar  bool                          `yaml:"bindParamsFromEnv,omitempty"`
 	Interactive bool                          `yaml:"interactive,omitempty"`
 	Private     bool                          `yaml:"private,omitempty"`
+	Confirm     *ConfirmConfig                `yaml:"confirm,omitempty"`
+	EnvFiles    []string                      `yaml:"envFiles,omitempty"`
+	Env         map[string]string             `yaml:"env,omitempty"`
+	Workdir     string                        `yaml:"workdir,omitempty"`
+	Shell       string                        `yaml:"shell,omitempty"`
+	Produces    []string                      `yaml:"produces,omitempty"`
+	Consumes    []string                      `yaml:"consumes,omitempty"`
+	Output      string                        `yaml:"output,omitempty"`
+	OutputFile  string                        `yaml:"outputFile,omitempty"`
 }
 
 func (t *TaskDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
@@ -108,10 +133,22 @@ func (t *TaskDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if v2.Import != "" {
 		log.Debugf("Importing %s", v2.Import)
 
-		err := get.Unmarshal(v2.Import, &v2)
+		bytes, path, err := get.GetFile(v2.Import)
 		if err != nil {
 			return err
 		}
+		// Script files of the imported tasks are relative to the imported file
+		dir, err := filepath.Abs(filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		bytes, err = withScriptFiles(bytes, dir)
+		if err != nil {
+			return errors.Wrapf(err, "failed to import %s", v2.Import)
+		}
+		if err := yaml.Unmarshal(bytes, &v2); err != nil {
+			return err
+		}
 	}
 
 	var script string
@@ -142,6 +179,11 @@ func (t *TaskDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
 				ArgumentIndex: &c,
 				Type:          p.Type,
 				Default:       p.Default,
+				Secret:        p.Secret,
+				Short:         p.Short,
+				Aliases:       p.Aliases,
+				Deprecated:    p.Deprecated,
+				MustNotExist:  p.MustNotExist,
 				Remainings:    p.Remainings,
 				Properties:    p.Properties,
 			}
@@ -149,18 +191,23 @@ func (t *TaskDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
 		}
 		for _, o := range v2.Options {
 			input := &InputConfig{
-				Name:        o.Name,
-				Description: o.Description,
-				Type:        o.Type,
-				Default:     o.Default,
-				Remainings:  o.Remainings,
-				Properties:  o.Properties,
+				Name:         o.Name,
+				Description:  o.Description,
+				Type:         o.Type,
+				Default:      o.Default,
+				Secret:       o.Secret,
+				Short:        o.Short,
+				Aliases:      o.Aliases,
+				Deprecated:   o.Deprecated,
+				MustNotExist: o.MustNotExist,
+				Remainings:   o.Remainings,
+				Properties:   o.Properties,
 			}
 			t.Inputs = append(t.Inputs, input)
 		}
 	}
 	t.TaskDefs = TransformV2FlowConfigMapToArray(v2.TaskDefs)
-	steps, err := readStepsFromStepDefs(script, v2.Runner, v2.StepDefs)
+	steps, err := readStepsFromStepDefs(script, v2)
 	if err != nil {
 		return errors.Wrapf(err, "Error while reading v2 config")
 	}
@@ -171,6 +218,11 @@ func (t *TaskDef) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	t.BindParamsFromEnv = v2.BindEnvVar
 	t.Interactive = v2.Interactive
 	t.Private = v2.Private
+	t.Confirm = v2.Confirm
+	t.EnvFiles = v2.EnvFiles
+	t.Env = v2.Env
+	t.Workdir = v2.Workdir
+	t.Shell = v2.Shell
 
 	return nil
 }
@@ -186,6 +238,11 @@ func (t *TaskDef) CopyTo(other *TaskDef) {
 	other.BindParamsFromEnv = t.BindParamsFromEnv
 	other.Interactive = t.Interactive
 	other.Private = t.Private
+	other.Confirm = t.Confirm
+	other.EnvFiles = t.EnvFiles
+	other.Env = t.Env
+	other.Workdir = t.Workdir
+	other.Shell = t.Shell
 }
 
 func (t *TaskDef) Add(args []string, taskDef *TaskDef, f func(ctx ExecutionContext) (string, error)) error {
@@ -267,8 +324,10 @@ func LoadStep(config StepDef) (Step, error) {
 	return nil, errors.Wrapf(lastError, "all loader failed to load step")
 }
 
-func readStepsFromStepDefs(script string, runner map[string]interface{}, stepDefs []map[interface{}]interface{}) ([]Step, error) {
+// readStepsFromStepDefs reads the `steps` of the task, or the step to run the `script` of the task
+func readStepsFromStepDefs(script string, v2 *TaskDefV2) ([]Step, error) {
 	result := []Step{}
+	runner, stepDefs := v2.Runner, v2.StepDefs
 
 	if script != "" {
 		if len(stepDefs) > 0 {
@@ -283,6 +342,23 @@ func readStepsFromStepDefs(script string, runner map[string]interface{}, stepDef
 		if runner != nil {
 			raw["runner"] = runner
 		}
+		if v2.ScriptFile != "" {
+			raw["scriptFile"] = v2.ScriptFile
+			raw["template"] = v2.Template
+		}
+		if v2.Output != "" {
+			raw["output"] = v2.Output
+			raw["outputFile"] = v2.OutputFile
+		}
+		for key, globs := range map[string][]string{"produces": v2.Produces, "consumes": v2.Consumes} {
+			if len(globs) > 0 {
+				list := make([]interface{}, len(globs))
+				for i, g := range globs {
+					list[i] = g
+				}
+				raw[key] = list
+			}
+		}
 		s, err := LoadStep(NewStepDef(raw))
 
 		if err != nil {
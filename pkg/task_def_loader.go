@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
 	log "github.com/sirupsen/logrus"
 
@@ -25,9 +26,21 @@ func ReadTaskDefFromString(data string) (*TaskDef, error) {
 	return err, t
 }
 
+// ReadTaskDefFromBytes reads the task definition not read from a file, like the YAML embedded in a binary.
+// Relative `scriptFile` paths are rejected, as there's no directory to resolve them against.
 func ReadTaskDefFromBytes(data []byte) (*TaskDef, error) {
+	return readTaskDef(data, "")
+}
+
+// readTaskDef reads the task definition, resolving relative `scriptFile` paths against dir
+func readTaskDef(data []byte, dir string) (*TaskDef, error) {
 	log.Debugf("%s", string(data))
 
+	data, err := withScriptFiles(data, dir)
+	if err != nil {
+		return nil, err
+	}
+
 	c := NewDefaultTaskConfig()
 	if err := yaml.Unmarshal(data, c); err != nil {
 		return nil, errors.Wrapf(err, "yaml.Unmarshal failed: %v", err)
@@ -48,7 +61,7 @@ func ReadTaskDefFromFile(path string) (*TaskDef, error) {
 		return nil, fmt.Errorf("Error while loading %s", path)
 	}
 
-	t, err := ReadTaskDefFromBytes(yamlBytes)
+	t, err := readTaskDef(yamlBytes, filepath.Dir(path))
 
 	if err != nil {
 		return nil, errors.Wrapf(err, "Error while loading %s", path)
@@ -88,6 +88,13 @@ func (t TaskRunner) GenerateAutoenvRecursively(path string, env map[string]inter
 }
 
 func (t *TaskRunner) Run(project *Application, asInput bool, caller ...*Task) (string, error) {
+	span := project.Tracing.start(fmt.Sprintf("run %s", t.Name.ShortString()), attrApp.String(project.Name), attrTask.String(t.Name.ShortString()))
+	output, err := t.run(project, asInput, caller...)
+	span.end(err)
+	return output, err
+}
+
+func (t *TaskRunner) run(project *Application, asInput bool, caller ...*Task) (string, error) {
 	var ctx *log.Entry
 
 	if len(caller) > 0 {
@@ -119,7 +126,7 @@ func (t *TaskRunner) Run(project *Application, asInput bool, caller ...*Task) (s
 	}
 
 	for _, s := range t.Steps {
-		lastout, err = s.Run(context)
+		lastout, err = runStep(s, context)
 
 		if err != nil {
 			return lastout.String, errors.Wrap(err, "Task#Run failed while running a script")
@@ -0,0 +1,216 @@
+package variant
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type timingNode struct {
+	kind     string
+	name     string
+	caller   string
+	start    time.Time
+	end      time.Time
+	failed   bool
+	children []*timingNode
+}
+
+func (n *timingNode) label() string {
+	if n.name == "" {
+		return "(root)"
+	}
+	return n.name
+}
+
+func (n *timingNode) duration() time.Duration {
+	return n.end.Sub(n.start)
+}
+
+// TimingRecorder records the wall-clock duration of every task and step from the events emitted while running them.
+// Tasks run to provide inputs of another task are recorded as children of the latter.
+type TimingRecorder struct {
+	mu    sync.Mutex
+	roots []*timingNode
+	stack []*timingNode
+}
+
+func NewTimingRecorder() *TimingRecorder {
+	return &TimingRecorder{}
+}
+
+func (r *TimingRecorder) Emit(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch e.Type {
+	case EventTaskStarted, EventStepStarted:
+		n := &timingNode{
+			kind:   strings.TrimSuffix(string(e.Type), ".started"),
+			name:   e.Task,
+			caller: e.Caller,
+			start:  e.Time,
+		}
+		if e.Type == EventStepStarted {
+			n.name = e.Step
+		}
+		if len(r.stack) > 0 {
+			top := r.stack[len(r.stack)-1]
+			top.children = append(top.children, n)
+		} else {
+			r.roots = append(r.roots, n)
+		}
+		r.stack = append(r.stack, n)
+	case EventTaskFinished, EventStepFinished:
+		if len(r.stack) == 0 {
+			return
+		}
+		top := r.stack[len(r.stack)-1]
+		r.stack = r.stack[:len(r.stack)-1]
+		top.end = e.Time
+		top.failed = e.Error != ""
+	}
+}
+
+// merge adds the tasks and steps recorded by other, which must have finished running them
+func (r *TimingRecorder) merge(other *TimingRecorder) {
+	other.mu.Lock()
+	defer other.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.roots = append(r.roots, other.roots...)
+}
+
+func (r *TimingRecorder) tasks() []*timingNode {
+	var tasks []*timingNode
+	var walk func(nodes []*timingNode)
+	walk = func(nodes []*timingNode) {
+		for _, n := range nodes {
+			if n.kind == "task" {
+				tasks = append(tasks, n)
+			}
+			walk(n.children)
+		}
+	}
+	walk(r.roots)
+	return tasks
+}
+
+// PrintReport prints the tree of tasks and steps with their durations, followed by the slowest tasks
+func (r *TimingRecorder) PrintReport(w io.Writer, slowest int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fmt.Fprintln(w, "Timings:")
+
+	var printNode func(n *timingNode, indent, branch string)
+	printNode = func(n *timingNode, indent, branch string) {
+		label := n.label()
+		switch {
+		case n.kind == "step":
+			label = fmt.Sprintf("step %s", label)
+		case n.caller != "":
+			label = fmt.Sprintf("%s (input of %s)", label, n.caller)
+		}
+		if n.failed {
+			label += " [failed]"
+		}
+		fmt.Fprintf(w, "%-60s %10s\n", indent+branch+label, formatDuration(n.duration()))
+
+		childIndent := indent
+		switch branch {
+		case "├─ ":
+			childIndent += "│  "
+		case "└─ ":
+			childIndent += "   "
+		}
+		for i, c := range n.children {
+			b := "├─ "
+			if i == len(n.children)-1 {
+				b = "└─ "
+			}
+			printNode(c, childIndent, b)
+		}
+	}
+	for _, n := range r.roots {
+		printNode(n, "", "")
+	}
+
+	tasks := r.tasks()
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].duration() > tasks[j].duration()
+	})
+	if len(tasks) > slowest {
+		tasks = tasks[:slowest]
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Slowest tasks:")
+	for i, t := range tasks {
+		fmt.Fprintf(w, "%2d. %-55s %10s\n", i+1, t.label(), formatDuration(t.duration()))
+	}
+}
+
+type chromeTraceEvent struct {
+	Name      string            `json:"name"`
+	Category  string            `json:"cat"`
+	Phase     string            `json:"ph"`
+	Timestamp int64             `json:"ts"`
+	Duration  int64             `json:"dur"`
+	PID       int               `json:"pid"`
+	TID       int               `json:"tid"`
+	Args      map[string]string `json:"args,omitempty"`
+}
+
+// WriteChromeTrace writes the recorded timings in the Trace Event Format,
+// which can be loaded into chrome://tracing or https://ui.perfetto.dev
+func (r *TimingRecorder) WriteChromeTrace(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := []chromeTraceEvent{}
+	var walk func(nodes []*timingNode, task string)
+	walk = func(nodes []*timingNode, task string) {
+		for _, n := range nodes {
+			e := chromeTraceEvent{
+				Name:      n.label(),
+				Category:  n.kind,
+				Phase:     "X",
+				Timestamp: n.start.UnixNano() / int64(time.Microsecond),
+				Duration:  int64(n.duration() / time.Microsecond),
+				PID:       1,
+				TID:       1,
+				Args:      map[string]string{},
+			}
+			childTask := task
+			if n.kind == "step" {
+				e.Name = fmt.Sprintf("%s/%s", task, n.name)
+				e.Args["task"] = task
+			} else {
+				childTask = n.label()
+			}
+			if n.caller != "" {
+				e.Args["caller"] = n.caller
+			}
+			if n.failed {
+				e.Args["failed"] = "true"
+			}
+			events = append(events, e)
+			walk(n.children, childTask)
+		}
+	}
+	walk(r.roots, "")
+
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+	})
+}
+
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%.3fs", d.Seconds())
+}
@@ -0,0 +1,68 @@
+package variant
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestTimingRecorder(t *testing.T) {
+	r := NewTimingRecorder()
+
+	at := time.Date(2019, 10, 19, 0, 0, 0, 0, time.UTC)
+	after := func(ms int) time.Time {
+		return at.Add(time.Duration(ms) * time.Millisecond)
+	}
+
+	events := EventSinks{r}
+	events.Emit(Event{Type: EventRunStarted, Time: after(0), Task: "deploy"})
+	events.Emit(Event{Type: EventTaskStarted, Time: after(0), Task: "deploy"})
+	events.Emit(Event{Type: EventTaskStarted, Time: after(10), Task: "cluster", Caller: "deploy"})
+	events.Emit(Event{Type: EventStepStarted, Time: after(10), Task: "cluster", Step: "script"})
+	events.Emit(Event{Type: EventScriptStdout, Time: after(20), Task: "cluster", Step: "script", Line: "mycluster"})
+	events.Emit(Event{Type: EventStepFinished, Time: after(1010), Task: "cluster", Step: "script"})
+	events.Emit(Event{Type: EventTaskFinished, Time: after(1010), Task: "cluster", Caller: "deploy"})
+	events.Emit(Event{Type: EventStepStarted, Time: after(1010), Task: "deploy", Step: "script"})
+	events.Emit(Event{Type: EventStepFinished, Time: after(1510), Task: "deploy", Step: "script", Error: "exit status 1"})
+	events.Emit(Event{Type: EventTaskFinished, Time: after(1510), Task: "deploy", Error: "exit status 1"})
+	events.Emit(Event{Type: EventRunFinished, Time: after(1510), Task: "deploy"})
+
+	report := &bytes.Buffer{}
+	r.PrintReport(report, 5)
+
+	expected := `Timings:
+deploy [failed]                                                  1.510s
+├─ cluster (input of deploy)                                     1.000s
+│  └─ step script                                                1.000s
+└─ step script [failed]                                          0.500s
+
+Slowest tasks:
+ 1. deploy                                                      1.510s
+ 2. cluster                                                     1.000s
+`
+	if report.String() != expected {
+		t.Errorf("unexpected report:\nexpected:\n%s\ngot:\n%s", expected, report.String())
+	}
+
+	trace := &bytes.Buffer{}
+	if err := r.WriteChromeTrace(trace); err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		TraceEvents []chromeTraceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(trace.Bytes(), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range parsed.TraceEvents {
+		names = append(names, e.Name)
+	}
+	if len(names) != 4 || names[0] != "deploy" || names[1] != "cluster" || names[2] != "cluster/script" || names[3] != "deploy/script" {
+		t.Errorf("unexpected trace events: %v", names)
+	}
+	if d := parsed.TraceEvents[1].Duration; d != 1000000 {
+		t.Errorf("unexpected duration of cluster: %d", d)
+	}
+}
@@ -0,0 +1,168 @@
+package variant
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TraceExporterOTLP = "otlp"
+	TraceExporterFile = "file"
+
+	// TraceparentEnv is the environment variable to propagate the trace context from and to other processes,
+	// in the format of the W3C Trace Context `traceparent` header
+	TraceparentEnv = "TRACEPARENT"
+)
+
+var (
+	attrApp        = attribute.Key("variant.app")
+	attrTask       = attribute.Key("variant.task")
+	attrCaller     = attribute.Key("variant.caller")
+	attrStep       = attribute.Key("variant.step")
+	attrEnv        = attribute.Key("variant.env")
+	attrCommand    = attribute.Key("variant.command")
+	attrExitStatus = attribute.Key("variant.exit_status")
+)
+
+// Tracing records OpenTelemetry spans of tasks, steps and commands.
+//
+// Tasks and steps are run one at a time, so the span of whatever is running now is tracked with a stack
+// instead of threading context.Context through every task and step.
+// A nil Tracing records nothing.
+type Tracing struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	closers  []func() error
+
+	mu    sync.Mutex
+	stack []context.Context
+}
+
+// NewTracing sets up a tracer provider that exports spans with the exporter, either `otlp` or `file`.
+// The OTLP exporter is configured via the standard environment variables like `OTEL_EXPORTER_OTLP_ENDPOINT`.
+func NewTracing(appName, exporter, file string) (*Tracing, error) {
+	t := &Tracing{}
+
+	var exp sdktrace.SpanExporter
+	switch exporter {
+	case TraceExporterOTLP:
+		e, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to initialize otlp trace exporter")
+		}
+		exp = e
+	case TraceExporterFile:
+		if file == "" {
+			return nil, fmt.Errorf("--trace-file must be set to use the %q trace exporter", TraceExporterFile)
+		}
+		f, err := os.Create(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to open trace file")
+		}
+		t.closers = append(t.closers, f.Close)
+		e, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to initialize file trace exporter")
+		}
+		exp = e
+	default:
+		return nil, fmt.Errorf("unexpected trace exporter %q: use one of %s, %s", exporter, TraceExporterOTLP, TraceExporterFile)
+	}
+
+	t.provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", appName))),
+	)
+	t.tracer = t.provider.Tracer("github.com/mumoshu/variant")
+
+	// Join the trace of the parent process, if any
+	root := propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier{"traceparent": os.Getenv(TraceparentEnv)})
+	t.stack = []context.Context{root}
+
+	return t, nil
+}
+
+// fork returns the tracing exporting spans with the same provider, whose spans are children of the current span of
+// t and independent of the spans started with t afterwards, for runs running concurrently with the others
+func (t *Tracing) fork() *Tracing {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return &Tracing{provider: t.provider, tracer: t.tracer, stack: []context.Context{t.stack[len(t.stack)-1]}}
+}
+
+type tracingSpan struct {
+	tracing *Tracing
+	span    trace.Span
+}
+
+// start starts a span as a child of the current span, and makes it the current span until it ends
+func (t *Tracing) start(name string, attrs ...attribute.KeyValue) *tracingSpan {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ctx, span := t.tracer.Start(t.stack[len(t.stack)-1], name, trace.WithAttributes(attrs...))
+	t.stack = append(t.stack, ctx)
+	return &tracingSpan{tracing: t, span: span}
+}
+
+func (s *tracingSpan) end(err error, attrs ...attribute.KeyValue) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attrs...)
+	if err != nil {
+		msg := secrets.Mask(err.Error())
+		s.span.RecordError(errors.New(msg))
+		s.span.SetStatus(codes.Error, msg)
+	}
+	s.span.End()
+
+	t := s.tracing
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.stack) > 1 {
+		t.stack = t.stack[:len(t.stack)-1]
+	}
+}
+
+// Traceparent returns the current span context in the W3C `traceparent` format, to be passed to scripts
+// so that tools run by them can join the trace
+func (t *Tracing) Traceparent() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(t.stack[len(t.stack)-1], carrier)
+	return carrier.Get("traceparent")
+}
+
+// Shutdown flushes all the recorded spans to the exporter
+func (t *Tracing) Shutdown() error {
+	if t == nil {
+		return nil
+	}
+	err := t.provider.Shutdown(context.Background())
+	for _, c := range t.closers {
+		c()
+	}
+	return err
+}
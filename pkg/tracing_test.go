@@ -0,0 +1,81 @@
+package variant
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-tracing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv(TraceparentEnv, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	defer os.Unsetenv(TraceparentEnv)
+
+	file := filepath.Join(dir, "trace.jsonl")
+	tracing, err := NewTracing("myapp", TraceExporterFile, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	task := tracing.start("task deploy", attrTask.String("deploy"))
+	step := tracing.start("step script", attrStep.String("script"))
+	traceparent := tracing.Traceparent()
+	step.end(errors.New("exit status 1"), attrExitStatus.Int(1))
+	task.end(nil)
+
+	if err := tracing.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") {
+		t.Errorf("the traceparent passed to scripts must be in the trace of the parent process: %s", traceparent)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	type span struct {
+		Name        string
+		SpanContext struct{ TraceID, SpanID string }
+		Parent      struct{ SpanID string }
+		Status      struct{ Code string }
+	}
+	spans := map[string]span{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s span
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		spans[s.Name] = s
+	}
+
+	if len(spans) != 2 {
+		t.Fatalf("unexpected number of spans: %d", len(spans))
+	}
+	if p := spans["task deploy"].Parent.SpanID; p != "00f067aa0ba902b7" {
+		t.Errorf("unexpected parent of the task span: %s", p)
+	}
+	if p := spans["step script"].Parent.SpanID; p != spans["task deploy"].SpanContext.SpanID {
+		t.Errorf("the step span must be a child of the task span: %s", p)
+	}
+	if !strings.Contains(traceparent, spans["step script"].SpanContext.SpanID) {
+		t.Errorf("the traceparent passed to scripts must point to the current span: %s", traceparent)
+	}
+	if c := spans["step script"].Status.Code; c != "Error" {
+		t.Errorf("unexpected status of the failed step span: %s", c)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/mumoshu/variant/pkg/cli/env"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -18,12 +19,17 @@ type CobraApp struct {
 }
 
 func (a *CobraApp) Run(args []string) (map[string]string, error) {
+	defer a.VariantApp.Events.Close()
+
 	c := a.cobraCmd
 
 	c.SetArgs(append([]string{}, args...))
 
 	c.SilenceErrors = true
 	c.SilenceUsage = true
+	// The command may be executed twice below, so the run is cleaned up and reported once after the last execution
+	defer a.finish()
+
 	cmd, err := a.cobraCmd.ExecuteC()
 	if err != nil {
 		if cmd != nil {
@@ -63,12 +69,33 @@ func (a *CobraApp) Run(args []string) (map[string]string, error) {
 	return a.VariantApp.LastOutputs, nil
 }
 
+// finish removes the workspace of the run, and writes the reports and the traces of the tasks run
+func (a *CobraApp) finish() {
+	p := a.VariantApp
+	if err := p.workspace.remove(); err != nil {
+		p.Log.Errorf("failed to remove the workspace: %v", err)
+	}
+	if err := p.ReportTimings(); err != nil {
+		p.Log.Errorf("%v", err)
+	}
+	if err := p.WriteJUnitReport(); err != nil {
+		p.Log.Errorf("%v", err)
+	}
+	if err := p.Tracing.Shutdown(); err != nil {
+		p.Log.Errorf("failed to export traces: %v", err)
+	}
+}
+
 type Opts struct {
 	CommandPath string
 	Args        []string
 	Log         *logrus.Logger
+	// Variantfile is the path to the file the tasks are loaded from. Empty when the tasks are embedded in the command
+	Variantfile string
 
 	ExtraCmds []*cobra.Command
+	// AppCmds create extra commands working with the application being initialized, like the ones running its tasks
+	AppCmds []func(*Application) *cobra.Command
 }
 
 func Init(commandPath string, rootTaskConfig *TaskDef, opts ...Opts) (*CobraApp, error) {
@@ -84,6 +111,9 @@ func Init(commandPath string, rootTaskConfig *TaskDef, opts ...Opts) (*CobraApp,
 	if log == nil {
 		log = logrus.StandardLogger()
 	}
+	maskSecretsInLogs(log)
+	// Scripts' outputs are logged via the standard logger regardless of the logger given via opts
+	maskSecretsInLogs(logrus.StandardLogger())
 
 	var err error
 
@@ -116,6 +146,7 @@ func Init(commandPath string, rootTaskConfig *TaskDef, opts ...Opts) (*CobraApp,
 	p := &Application{
 		Name:                commandName,
 		CommandRelativePath: commandPath,
+		Variantfile:         o.Variantfile,
 		CachedTaskOutputs:   map[string]interface{}{},
 		Env:                 envFromFile,
 		TaskNamer:           taskNamer,
@@ -124,6 +155,8 @@ func Init(commandPath string, rootTaskConfig *TaskDef, opts ...Opts) (*CobraApp,
 		Viper:               v,
 		Log:                 log,
 		CommandName:         commandName,
+		inputFlags:          map[string]*pflag.Flag{},
+		workspace:           newWorkspace(),
 	}
 
 	adapter := NewCobraAdapter(p)
@@ -137,7 +170,9 @@ func Init(commandPath string, rootTaskConfig *TaskDef, opts ...Opts) (*CobraApp,
 		return p.UpdateLoggingConfiguration()
 	}
 
-	adapter.GenerateAllFlags()
+	if err := adapter.GenerateAllFlags(); err != nil {
+		log.Fatalf("error: %v", err)
+	}
 
 	rootCmd.PersistentFlags().BoolVarP(&(p.Verbose), "verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().StringVarP(&(p.Output), "output", "o", "text", "Output format. One of: json|text|bunyan")
@@ -147,6 +182,15 @@ func Init(commandPath string, rootTaskConfig *TaskDef, opts ...Opts) (*CobraApp,
 	rootCmd.PersistentFlags().BoolVar(&(p.LogToStderr), "logtostderr", true, "write log messages to stderr")
 	rootCmd.PersistentFlags().StringArrayVarP(&(p.ConfigContexts), "config-context", "x", []string{}, "Config context")
 	rootCmd.PersistentFlags().StringArrayVarP(&(p.ConfigDirs), "config-dir", "d", []string{}, "Config dir")
+	rootCmd.PersistentFlags().BoolVarP(&(p.Yes), "yes", "y", false, "Run tasks requiring confirmation without asking")
+	rootCmd.PersistentFlags().BoolVar(&(p.NoInput), "no-input", false, "Never prompt for missing inputs, even when stdin is a terminal")
+	rootCmd.PersistentFlags().StringVar(&(p.ContainerRuntime), "container-runtime", "", "Container runtime to run steps with `runner.image` by default. One of: docker|podman|nerdctl")
+	rootCmd.PersistentFlags().StringVar(&(p.EventsFile), "events-file", "", "Path to the file to write the events of task runs as JSON lines")
+	rootCmd.PersistentFlags().BoolVar(&(p.Timings), "timings", false, "Print durations of all the tasks and steps after the run")
+	rootCmd.PersistentFlags().StringVar(&(p.TimingsTrace), "timings-trace", "", "Path to the file to write durations of all the tasks and steps in the Chrome trace event format")
+	rootCmd.PersistentFlags().StringVar(&(p.JUnitReport), "junit-report", "", "Path to the file to write the JUnit XML report of all the tasks and steps")
+	rootCmd.PersistentFlags().StringVar(&(p.TraceExporter), "trace-exporter", "", "Export OpenTelemetry spans of tasks and steps with the exporter. One of: otlp|file")
+	rootCmd.PersistentFlags().StringVar(&(p.TraceFile), "trace-file", "", "Path to the file to write OpenTelemetry spans as JSON. Implies --trace-exporter=file when the exporter is not set")
 
 	rootCmd.PersistentFlags().StringVarP(&(p.LogLevel), "log-level", "", "info", "Log level. One of: panic|fatal|error|warn|info|debug|trace")
 	rootCmd.PersistentFlags().StringVarP(&(p.LogColorPanic), "log-color-panic", "", "red", "Log message color: panic")
@@ -179,6 +223,39 @@ func Init(commandPath string, rootTaskConfig *TaskDef, opts ...Opts) (*CobraApp,
 		return nil, err
 	}
 
+	if !p.NoInput {
+		p.Prompter = NewTerminalInputPrompter()
+	}
+
+	if p.EventsFile != "" {
+		w, err := OpenEventsFile(p.EventsFile)
+		if err != nil {
+			return nil, err
+		}
+		p.Events = append(p.Events, w)
+	}
+
+	if p.Timings || p.TimingsTrace != "" {
+		p.TimingRecorder = NewTimingRecorder()
+		p.Events = append(p.Events, p.TimingRecorder)
+	}
+
+	if p.JUnitReport != "" {
+		p.JUnitReporter = NewJUnitReporter(commandName)
+		p.Events = append(p.Events, p.JUnitReporter)
+	}
+
+	if p.TraceExporter != "" || p.TraceFile != "" {
+		exporter := p.TraceExporter
+		if exporter == "" {
+			exporter = TraceExporterFile
+		}
+		p.Tracing, err = NewTracing(commandName, exporter, p.TraceFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Load a config from the provided flag (could be loaded through Viper as well)
 	if p.ConfigFile != "" {
 		p.loadConfigFile(p.ConfigFile)
@@ -197,13 +274,18 @@ func Init(commandPath string, rootTaskConfig *TaskDef, opts ...Opts) (*CobraApp,
 		p.loadConfig(envConfigName)
 	}
 
+	extraCmds := append([]*cobra.Command{}, o.ExtraCmds...)
+	for _, newCmd := range o.AppCmds {
+		extraCmds = append(extraCmds, newCmd(p))
+	}
+
 	// Hide built-in commands in help
 	v.SetDefault("hide_extra_cmds", false)
-	if len(o.ExtraCmds) > 0 {
-		for k, _ := range o.ExtraCmds {
-			o.ExtraCmds[k].Hidden = v.GetBool("hide_extra_cmds")
+	if len(extraCmds) > 0 {
+		for k, _ := range extraCmds {
+			extraCmds[k].Hidden = v.GetBool("hide_extra_cmds")
 		}
-		rootCmd.AddCommand(o.ExtraCmds...)
+		rootCmd.AddCommand(extraCmds...)
 	}
 
 	//Set the environment prefix as app name
@@ -0,0 +1,142 @@
+package variant
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runTask runs the command of the task definition with the args, as `variant` does
+func runTask(t *testing.T, def string, args ...string) (*Application, map[string]string) {
+	t.Helper()
+	defer func(loaders []StepLoader) { stepLoaders = loaders }(stepLoaders)
+	Register(NewScriptStepLoader())
+	taskDef, err := ReadTaskDefFromString(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taskDef.Name = "mycmd"
+	app, err := Init("mycmd", taskDef, Opts{Args: args, Log: logrus.StandardLogger()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs, err := app.Run(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app.VariantApp, outputs
+}
+
+// runWithArgument runs the root task of `mycmd` taking a positional argument, which is run by re-executing the command
+// after cobra fails with `unknown command`, with the global flags followed by the argument
+func runWithArgument(t *testing.T, flags ...string) *Application {
+	t.Helper()
+	app, outputs := runTask(t, `
+inputs:
+- name: name
+  argument-index: 0
+  type: string
+script: |
+  echo hello {{ .name }}
+tasks:
+  other:
+    script: echo other
+`, append(flags, "bob")...)
+	if outputs[""] != "hello bob" {
+		t.Fatalf("unexpected outputs: %v", outputs)
+	}
+	return app
+}
+
+func TestCobraAppRunReportsTimingsAfterTheTask(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	trace := filepath.Join(dir, "timings.json")
+	runWithArgument(t, "--timings-trace="+trace)
+	data, err := ioutil.ReadFile(trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"name":"(root)"`) {
+		t.Errorf("the task is missing in the timings: %s", data)
+	}
+}
+
+func TestCobraAppRunWritesJUnitReportAfterTheTask(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	report := filepath.Join(dir, "junit.xml")
+	runWithArgument(t, "--junit-report="+report)
+	data, err := ioutil.ReadFile(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `tests="2"`) || !strings.Contains(string(data), "hello bob") {
+		t.Errorf("the task is missing in the report: %s", data)
+	}
+}
+
+func TestCobraAppRunExportsSpansOfTheTask(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "trace.jsonl")
+	runWithArgument(t, "--trace-file="+file)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"Name":"step script"`) {
+		t.Errorf("the spans of the task are missing: %s", data)
+	}
+}
+
+func TestCobraAppRunRemovesTheWorkspaceOfTheTask(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-run")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "tmp")
+	if err := os.Mkdir(tmp, 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(tmpdir string) { os.Setenv("TMPDIR", tmpdir) }(os.Getenv("TMPDIR"))
+	os.Setenv("TMPDIR", tmp)
+
+	runTask(t, `
+inputs:
+- name: name
+  argument-index: 0
+  type: string
+- name: dir
+  type: string
+workdir: "{{ .dir }}"
+script: |
+  echo {{ .name }} > name.txt
+produces:
+- name.txt
+tasks:
+  other:
+    script: echo other
+`, "--dir="+dir, "bob")
+	if left, _ := ioutil.ReadDir(tmp); len(left) != 0 {
+		t.Errorf("workspaces left: %v", left)
+	}
+}
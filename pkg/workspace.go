@@ -0,0 +1,151 @@
+package variant
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// workspace is the directory to pass files produced by steps to the steps consuming them within a run, without
+// external storage. The directory is created on first use and removed after the run.
+type workspace struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newWorkspace() *workspace {
+	return &workspace{}
+}
+
+// path returns the absolute path to the workspace, creating the directory if it doesn't exist yet
+func (w *workspace) path() (string, error) {
+	if w == nil {
+		return "", fmt.Errorf("workspace is not available")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dir == "" {
+		dir, err := ioutil.TempDir("", "variant-workspace")
+		if err != nil {
+			return "", err
+		}
+		w.dir = dir
+	}
+	return w.dir, nil
+}
+
+// remove removes the workspace. The next call to path creates a new one.
+func (w *workspace) remove() error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dir == "" {
+		return nil
+	}
+	if err := os.RemoveAll(w.dir); err != nil {
+		return err
+	}
+	w.dir = ""
+	return nil
+}
+
+// produce copies the files and directories matching the globs relative to dir into the workspace, at the same
+// relative paths
+func (w *workspace) produce(globs []string, dir string) error {
+	ws, err := w.path()
+	if err != nil {
+		return err
+	}
+	if dir == "" {
+		dir = "."
+	}
+	for _, glob := range globs {
+		if filepath.IsAbs(glob) {
+			return fmt.Errorf("produces %q must be a path relative to the directory the step runs in", glob)
+		}
+		matches, err := filepath.Glob(filepath.Join(dir, glob))
+		if err != nil {
+			return errors.Wrapf(err, "invalid produces %q", glob)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("no files match produces %q in %s", glob, dir)
+		}
+		for _, m := range matches {
+			rel, err := filepath.Rel(dir, m)
+			if err != nil {
+				return err
+			}
+			if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("produces %q must not refer to files outside of %s", glob, dir)
+			}
+			if err := copyPath(m, filepath.Join(ws, rel)); err != nil {
+				return errors.Wrapf(err, "failed to copy %s into the workspace", m)
+			}
+		}
+	}
+	return nil
+}
+
+// consume returns the absolute paths to the files and directories in the workspace matching the globs, sorted
+func (w *workspace) consume(globs []string) ([]string, error) {
+	ws, err := w.path()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, glob := range globs {
+		matches, err := filepath.Glob(filepath.Join(ws, glob))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid consumes %q", glob)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files in the workspace match consumes %q. Produce them with `produces` in a step run earlier", glob)
+		}
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// copyPath copies the file, or the directory recursively, to dst
+func copyPath(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+}
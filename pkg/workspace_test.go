@@ -0,0 +1,72 @@
+package variant
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWorkspace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "variant-workspace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, f := range []string{"dist/app.tgz", "dist/app.sha256", "reports/unit/junit.xml"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(f), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ws := newWorkspace()
+	defer ws.remove()
+
+	if err := ws.produce([]string{"dist/*.tgz", "reports"}, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	wsDir, err := ws.path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumed, err := ws.consume([]string{"reports/unit/*.xml", "dist/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{filepath.Join(wsDir, "dist/app.tgz"), filepath.Join(wsDir, "reports/unit/junit.xml")}
+	if !reflect.DeepEqual(consumed, expected) {
+		t.Errorf("unexpected files: expected %v, got %v", expected, consumed)
+	}
+
+	if _, err := ws.consume([]string{"dist/*.sha256"}); err == nil {
+		t.Error("expected an error for the file not produced")
+	}
+	if err := ws.produce([]string{"../*"}, filepath.Join(dir, "dist")); err == nil {
+		t.Error("expected an error for the files outside of the directory")
+	}
+	if err := ws.produce([]string{"build/*"}, dir); err == nil {
+		t.Error("expected an error for the glob matching nothing")
+	}
+
+	if err := ws.remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(wsDir); !os.IsNotExist(err) {
+		t.Errorf("workspace not removed: %v", err)
+	}
+
+	// The workspace is recreated when used after removed
+	if err := ws.produce([]string{"dist/*.tgz"}, dir); err != nil {
+		t.Fatal(err)
+	}
+	if recreated, err := ws.path(); err != nil || recreated == wsDir {
+		t.Errorf("workspace not recreated: %s, %v", recreated, err)
+	}
+}